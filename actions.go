@@ -0,0 +1,191 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrDependencyCycle is returned by NewWatcher when the DependsOn of
+	// cfg.Actions form a cycle.
+	ErrDependencyCycle = errors.New("dependency cycle")
+	// ErrPrerequisiteFailed is reported for an action skipped because an
+	// action it depends on failed or was skipped in the same batch.
+	ErrPrerequisiteFailed = errors.New("prerequisite failed")
+)
+
+// Action is a named reload step of MultiConfig.Actions, such as reloading
+// certificates or restarting a server. It runs once per batch of changes
+// that includes any of its Files, after every action it depends on that
+// runs in the same batch.
+type Action struct {
+	Name      string                                                 // unique name, used in DependsOn, events and errors
+	Files     []string                                               // absolute paths of the files whose changes trigger it (watched even if not in TargetFiles)
+	DependsOn []string                                               // names of actions that must succeed first when they run in the same batch
+	Run       func(ctx context.Context, changes []ChangeEvent) error // called with the changes of Files in the batch
+}
+
+// actionGraph is the validated form of MultiConfig.Actions.
+type actionGraph struct {
+	order []*Action // every action, each after those it depends on
+}
+
+// newActionGraph checks that names are unique, dependencies exist and do
+// not form a cycle, and orders the actions. Actions that do not depend on
+// each other keep their declared order.
+func newActionGraph(actions []Action) (*actionGraph, error) {
+	byName := make(map[string]*Action, len(actions))
+	for i := range actions {
+		a := &actions[i]
+		switch {
+		case a.Name == "":
+			return nil, fmt.Errorf("action %d has no name", i)
+		case byName[a.Name] != nil:
+			return nil, fmt.Errorf("duplicate action %q", a.Name)
+		case a.Run == nil:
+			return nil, fmt.Errorf("action %q has no Run function", a.Name)
+		case len(a.Files) == 0:
+			return nil, fmt.Errorf("action %q has no files", a.Name)
+		}
+		byName[a.Name] = a
+	}
+	for _, a := range byName {
+		for _, dep := range a.DependsOn {
+			if byName[dep] == nil {
+				return nil, fmt.Errorf("action %q depends on unknown action %q", a.Name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	g := &actionGraph{}
+	marks := make(map[string]int, len(actions))
+	var path []string // actions being visited, for reporting a cycle
+	var visit func(a *Action) error
+	visit = func(a *Action) error {
+		switch marks[a.Name] {
+		case done:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, a.Name):], a.Name)
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+		}
+		marks[a.Name] = visiting
+		path = append(path, a.Name)
+		for _, dep := range a.DependsOn {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[a.Name] = done
+		g.order = append(g.order, a)
+		return nil
+	}
+	for i := range actions {
+		if err := visit(&actions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// files returns the files of every action, each once, in declared order.
+func (g *actionGraph) files() []string {
+	var files []string
+	for _, a := range g.order {
+		for _, f := range a.Files {
+			if !slices.Contains(files, f) {
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// runActions runs the actions affected by evs in dependency order and
+// returns the error for each event: the failures and skips of the actions
+// of its path, joined. A failed action's dependents in the batch are
+// skipped, and so are theirs.
+func (e *engine) runActions(ctx context.Context, evs []ChangeEvent) []error {
+	failed := make(map[string]bool)
+	pathErrs := make(map[string][]error)
+	for _, a := range e.actions.order {
+		var changes []ChangeEvent
+		for _, ev := range evs {
+			if slices.Contains(a.Files, ev.Path) {
+				changes = append(changes, ev)
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		var err error
+		for _, dep := range a.DependsOn {
+			if failed[dep] {
+				err = fmt.Errorf("action %s skipped: %w: %s", a.Name, ErrPrerequisiteFailed, dep)
+				e.event(err.Error())
+				break
+			}
+		}
+		if err == nil {
+			e.event("running action: " + a.Name)
+			if err = e.callAction(ctx, a, changes); err != nil {
+				err = fmt.Errorf("action %s: %w", a.Name, err)
+			}
+		}
+		if err != nil {
+			failed[a.Name] = true
+			for _, ev := range changes {
+				pathErrs[ev.Path] = append(pathErrs[ev.Path], err)
+			}
+		}
+	}
+
+	errs := make([]error, len(evs))
+	for i, ev := range evs {
+		e.dispatch(ev)
+		errs[i] = errors.Join(pathErrs[ev.Path]...)
+	}
+	return errs
+}
+
+// callAction runs a with the same panic and timeout protection as other
+// callbacks.
+func (e *engine) callAction(ctx context.Context, a *Action, changes []ChangeEvent) error {
+	h := HandlerFunc(func(ctx context.Context, _ ChangeEvent) error {
+		return a.Run(ctx, changes)
+	})
+	if e.callbackTimeout > 0 {
+		return callWithTimeout(ctx, h, changes[0], e.callbackTimeout)
+	}
+	return protect(ctx, h, changes[0])
+}
+
+// batch returns file together with every other target whose change is
+// still being debounced, cancelling their timers, so that files changed
+// together are handed to the actions together.
+func (e *engine) batch(ctx context.Context, file string) []string {
+	files := []string{file}
+	for _, t := range e.targets {
+		if slices.Contains(files, t.path) || t.graced || !e.pending(t.path) {
+			continue // graced targets wait out their removal grace
+		}
+		e.cancel(t.path)
+		if !e.settled(ctx, t.path) {
+			continue
+		}
+		e.journalChange(JournalChange, e.change(t.path), "")
+		e.event("sending signal for: " + t.path)
+		files = append(files, t.path)
+	}
+	return files
+}
@@ -0,0 +1,129 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewWatcher_ValidatesActions(t *testing.T) {
+	run := func(context.Context, []ChangeEvent) error { return nil }
+	file := filepath.Join(t.TempDir(), "config.yaml")
+
+	_, err := NewWatcher(MultiConfig{Actions: []Action{
+		{Name: "a", Files: []string{file}, DependsOn: []string{"b"}, Run: run},
+		{Name: "b", Files: []string{file}, DependsOn: []string{"c"}, Run: run},
+		{Name: "c", Files: []string{file}, DependsOn: []string{"a"}, Run: run},
+	}})
+	if !errors.Is(err, ErrDependencyCycle) || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("expected the cycle to be reported, got %v", err)
+	}
+
+	_, err = NewWatcher(MultiConfig{Actions: []Action{
+		{Name: "a", Files: []string{file}, DependsOn: []string{"missing"}, Run: run},
+	}})
+	if err == nil || !strings.Contains(err.Error(), `unknown action "missing"`) {
+		t.Errorf("expected an unknown dependency error, got %v", err)
+	}
+
+	_, err = NewWatcher(MultiConfig{
+		Actions:  []Action{{Name: "a", Files: []string{file}, Run: run}},
+		OnChange: func(string) {},
+	})
+	if err == nil {
+		t.Error("expected an error for Actions together with OnChange")
+	}
+}
+
+func TestWatcher_ActionsRunInDependencyOrder(t *testing.T) {
+	dir := t.TempDir()
+	cert, config, bin := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "config.yaml"), filepath.Join(dir, "server")
+	for _, file := range []string{cert, config, bin} {
+		if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	var ran []string
+	certsFail := errors.New("bad certificate")
+	failCerts := false
+	action := func(name string) func(context.Context, []ChangeEvent) error {
+		return func(_ context.Context, changes []ChangeEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, name)
+			if name == "certs" && failCerts {
+				return certsFail
+			}
+			return nil
+		}
+	}
+	errs := make(chan error, 8)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{config},
+		Debounce:    100 * time.Millisecond,
+		OnError:     func(err error) { errs <- err },
+		Actions: []Action{
+			{Name: "restart", Files: []string{bin}, DependsOn: []string{"config"}, Run: action("restart")},
+			{Name: "config", Files: []string{config}, DependsOn: []string{"certs"}, Run: action("config")},
+			{Name: "certs", Files: []string{cert}, Run: action("certs")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy && len(w.Status().Targets) == 3 })
+
+	writeAll := func(content string) {
+		t.Helper()
+		for _, file := range []string{bin, config, cert} {
+			if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	ranNow := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(ran)
+	}
+
+	writeAll("b")
+	waitFor(t, func() bool { return len(ranNow()) == 3 })
+	if got, want := ranNow(), []string{"certs", "config", "restart"}; !slices.Equal(got, want) {
+		t.Fatalf("actions ran as %v, want %v", got, want)
+	}
+
+	mu.Lock()
+	ran, failCerts = nil, true
+	mu.Unlock()
+	writeAll("c")
+	waitFor(t, func() bool { return len(errs) == 3 })
+	time.Sleep(50 * time.Millisecond)
+	if got := ranNow(); !slices.Equal(got, []string{"certs"}) {
+		t.Errorf("dependents of the failed action ran: %v", got)
+	}
+	var skipped int
+	for range 3 {
+		switch err := <-errs; {
+		case errors.Is(err, ErrPrerequisiteFailed):
+			skipped++
+		case !errors.Is(err, certsFail):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if skipped != 2 {
+		t.Errorf("%d actions reported as skipped, want 2", skipped)
+	}
+}
@@ -0,0 +1,45 @@
+package reloader
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// AdminHandler returns an http.Handler exposing w for operators:
+//
+//	GET  /                 Status as JSON (503 if the watcher is unhealthy)
+//	POST /reload[?path=P]  Watcher.Reload for P, or every target
+//
+// Mount it below a prefix with http.StripPrefix.
+func AdminHandler(w *Watcher) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(rw http.ResponseWriter, _ *http.Request) {
+		st := w.Status()
+		code := http.StatusOK
+		if !st.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(rw, code, st)
+	})
+	mux.HandleFunc("POST /reload", func(rw http.ResponseWriter, r *http.Request) {
+		err := w.Reload(r.Context(), r.URL.Query().Get("path"))
+		switch {
+		case err == nil:
+			writeJSON(rw, http.StatusOK, w.Status())
+		case errors.Is(err, ErrUnknownTarget):
+			writeJSON(rw, http.StatusNotFound, map[string]string{"error": err.Error()})
+		case errors.Is(err, ErrNotRunning):
+			writeJSON(rw, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(rw, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	})
+	return mux
+}
+
+func writeJSON(rw http.ResponseWriter, code int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,56 @@
+package reloader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	reloads := 0
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{file},
+		OnChange:    func(string) { reloads++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := AdminHandler(w)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("reload before Run: status %d, want 503", rec.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy })
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload?path="+file, nil))
+	if rec.Code != http.StatusOK || reloads != 1 {
+		t.Errorf("reload: status %d with %d reloads, want 200 and 1", rec.Code, reloads)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload?path=/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("reload of unknown path: status %d, want 404", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var st Status
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !st.Healthy || len(st.Targets) != 1 || st.Targets[0].Reloads != 1 {
+		t.Errorf("status: %d %+v", rec.Code, st)
+	}
+}
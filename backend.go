@@ -0,0 +1,61 @@
+package reloader
+
+import (
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// EventSource delivers filesystem notifications for the directories added to
+// it. It mirrors the parts of *fsnotify.Watcher the watcher uses.
+type EventSource interface {
+	Add(name string) error
+	Remove(name string) error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// Backend is the filesystem a watcher observes. The default backend uses
+// fsnotify and the os package; tests can substitute an in-memory one (see the
+// reloadertest package).
+type Backend interface {
+	NewEventSource() (EventSource, error)
+	Stat(name string) (fs.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+}
+
+// OSBackend is the default Backend, backed by fsnotify and the os package.
+type OSBackend struct{}
+
+// NewEventSource creates an fsnotify watcher.
+func (OSBackend) NewEventSource() (EventSource, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return fsnotifySource{w}, nil
+}
+
+// Stat calls os.Stat.
+func (OSBackend) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Open calls os.Open.
+func (OSBackend) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name) // #nosec G304 - the watched files are chosen by the caller
+}
+
+// fsnotifySource adapts *fsnotify.Watcher to EventSource.
+type fsnotifySource struct {
+	w *fsnotify.Watcher
+}
+
+func (s fsnotifySource) Add(name string) error         { return s.w.Add(name) }
+func (s fsnotifySource) Remove(name string) error      { return s.w.Remove(name) }
+func (s fsnotifySource) Events() <-chan fsnotify.Event { return s.w.Events }
+func (s fsnotifySource) Errors() <-chan error          { return s.w.Errors }
+func (s fsnotifySource) Close() error                  { return s.w.Close() }
@@ -0,0 +1,149 @@
+package reloader
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ChangesBuffer is the capacity of the channel returned by Changes.
+const ChangesBuffer = 16
+
+// ChangeEvent describes one debounced change of a watched file.
+type ChangeEvent struct {
+	Path   string      // the target file that changed
+	Op     fsnotify.Op // every operation seen during the debounce window, 0 if none
+	Time   time.Time   // when the last trigger was seen
+	Source string      // the last trigger: "file:<path>", "signal:<name>", "manual", "start" (FireOnStart) or "state" (changed since the last run)
+}
+
+// Handler handles debounced changes. An error marks the reload as failed: it
+// is passed to OnError and shown by Status.
+type Handler interface {
+	HandleChange(ctx context.Context, ev ChangeEvent) error
+}
+
+// HandlerFunc adapts a function to the Handler interface.
+type HandlerFunc func(ctx context.Context, ev ChangeEvent) error
+
+// HandleChange calls f(ctx, ev).
+func (f HandlerFunc) HandleChange(ctx context.Context, ev ChangeEvent) error {
+	return f(ctx, ev)
+}
+
+// Changes watches cfg.TargetFiles like WatchMultiple but delivers debounced
+// changes on a channel instead of calling cfg.OnChange or cfg.Handler, which
+// must both be nil, as must cfg.Actions, cfg.Middleware and
+// cfg.CallbackTimeout. Configuration errors are returned immediately.
+//
+// The channel buffers up to ChangesBuffer events. Once it is full the
+// watcher's loop blocks until the consumer receives one, like it does
+// during a slow callback. While it is blocked no filesystem events are
+// read, debounce timers are not handled, Status is not updated and Watcher
+// methods wait. Events queue up in the kernel and are handled once the
+// consumer catches up; if the queue overflows meanwhile, a rescan finds
+// the targets that changed. A slow consumer therefore delays changes but
+// does not lose them, though changes lost to an overflow are delivered as
+// a single Write, Create or Remove.
+//
+// The channel is closed when ctx is done or cfg.Retry gives up; in the
+// latter case the error is passed to cfg.OnError first.
+func Changes(ctx context.Context, cfg MultiConfig) (<-chan ChangeEvent, error) {
+	if err := checkChangesConfig(cfg, "Changes"); err != nil {
+		return nil, err
+	}
+	e, err := newMultiEngine(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan ChangeEvent, ChangesBuffer)
+	e.onChange = func(ctx context.Context, ev ChangeEvent) error {
+		select {
+		case changes <- ev:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	go func() {
+		defer close(changes)
+		if err := e.run(ctx); err != nil && ctx.Err() == nil {
+			e.reportError(err)
+		}
+	}()
+	return changes, nil
+}
+
+// checkChangesConfig rejects the fields of cfg that Changes and ChangesSeq,
+// named fn, cannot honour. A timeout, whether CallbackTimeout or the Timeout
+// middleware, would drop a change the consumer is slow to receive and
+// report a failed reload.
+func checkChangesConfig(cfg MultiConfig, fn string) error {
+	switch {
+	case cfg.OnChange != nil || cfg.Handler != nil:
+		return fmt.Errorf("OnChange and Handler must not be set when using %s", fn)
+	case len(cfg.Actions) > 0:
+		return fmt.Errorf("Actions must not be set when using %s", fn)
+	case len(cfg.Middleware) > 0 || cfg.CallbackTimeout > 0:
+		return fmt.Errorf("Middleware and CallbackTimeout must not be set when using %s", fn)
+	}
+	return nil
+}
+
+// ChangesSeq is the iterator form of Changes. Every change is yielded with
+// a nil error, and the watcher does not deliver the next one until the loop
+// body returns; it is blocked meanwhile, as when the channel of Changes is
+// full. The sequence ends after yielding the error that stopped the
+// watcher: a configuration error, the error wrapping ErrRetriesExhausted or
+// ctx.Err(). Breaking out of the loop stops the watcher.
+//
+//	for ev, err := range reloader.ChangesSeq(ctx, cfg) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    reload(ev.Path)
+//	}
+func ChangesSeq(ctx context.Context, cfg MultiConfig) iter.Seq2[ChangeEvent, error] {
+	return func(yield func(ChangeEvent, error) bool) {
+		if err := checkChangesConfig(cfg, "ChangesSeq"); err != nil {
+			yield(ChangeEvent{}, err)
+			return
+		}
+		e, err := newMultiEngine(cfg)
+		if err != nil {
+			yield(ChangeEvent{}, err)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		changes := make(chan ChangeEvent)
+		e.onChange = func(ctx context.Context, ev ChangeEvent) error {
+			select {
+			case changes <- ev:
+			case <-ctx.Done():
+			}
+			return nil
+		}
+		done := make(chan error, 1)
+		go func() { done <- e.run(ctx) }()
+
+		for {
+			select {
+			case ev := <-changes:
+				if !yield(ev, nil) {
+					cancel()
+					<-done
+					return
+				}
+			case err := <-done:
+				yield(ChangeEvent{}, err)
+				return
+			}
+		}
+	}
+}
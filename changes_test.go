@@ -0,0 +1,253 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestChanges_DeliversDebouncedEvents(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := Changes(ctx, MultiConfig{
+		TargetFiles: []string{file},
+		Debounce:    50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	for range 3 {
+		if err := os.WriteFile(file, []byte("a: 1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case ev := <-changes:
+		if ev.Path != file {
+			t.Errorf("Path = %q, want %q", ev.Path, file)
+		}
+		if !ev.Op.Has(fsnotify.Create) || !ev.Op.Has(fsnotify.Write) {
+			t.Errorf("Op = %v, want Create and Write", ev.Op)
+		}
+		if ev.Time.IsZero() {
+			t.Error("Time is not set")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change delivered")
+	}
+
+	select {
+	case ev := <-changes:
+		t.Fatalf("writes were not debounced into one change, got another: %+v", ev)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatal("unexpected change after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after cancellation")
+	}
+}
+
+func TestChanges_InvalidConfig(t *testing.T) {
+	if _, err := Changes(context.Background(), MultiConfig{}); err == nil {
+		t.Error("expected an error without target files")
+	}
+	_, err := Changes(context.Background(), MultiConfig{
+		TargetFiles: []string{"/tmp/x"},
+		OnChange:    func(string) {},
+	})
+	if err == nil {
+		t.Error("expected an error when OnChange is set")
+	}
+	_, err = Changes(context.Background(), MultiConfig{
+		TargetFiles:     []string{"/tmp/x"},
+		CallbackTimeout: time.Second,
+	})
+	if err == nil {
+		t.Error("expected an error when CallbackTimeout is set")
+	}
+	for _, err := range ChangesSeq(context.Background(), MultiConfig{
+		TargetFiles: []string{"/tmp/x"},
+		Middleware:  []Middleware{Timeout(time.Second)},
+	}) {
+		if err == nil {
+			t.Error("expected an error when Middleware is set")
+		}
+	}
+}
+
+func TestChangesSeq_YieldsChangesAndStopsOnBreak(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(file, []byte("a: 1\n"), 0o600)
+	}()
+
+	var got []string
+	for ev, err := range ChangesSeq(ctx, MultiConfig{
+		TargetFiles: []string{file},
+		Debounce:    20 * time.Millisecond,
+	}) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, ev.Path)
+		break
+	}
+	if len(got) != 1 || got[0] != file {
+		t.Errorf("got %v, want [%s]", got, file)
+	}
+}
+
+func TestChangesSeq_YieldsTerminalError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var errs []error
+	for _, err := range ChangesSeq(ctx, MultiConfig{TargetFiles: []string{filepath.Join(t.TempDir(), "f")}}) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Errorf("got %v, want a single context.DeadlineExceeded", errs)
+	}
+}
+
+func TestChanges_CoalescesAtomicSaves(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := Changes(ctx, MultiConfig{
+		TargetFiles:   []string{file},
+		Debounce:      50 * time.Millisecond,
+		CoalesceSaves: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	tmp := filepath.Join(dir, "config.yaml.tmp")
+	if err := os.WriteFile(tmp, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-changes:
+		if ev.Op != fsnotify.Write {
+			t.Errorf("Op = %v, want WRITE", ev.Op)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change delivered")
+	}
+
+	// A file created and removed within the window is not a change.
+	other := filepath.Join(dir, "new.yaml")
+	if _, err := os.Stat(other); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	changes2, err := Changes(ctx, MultiConfig{
+		TargetFiles:   []string{other},
+		Debounce:      50 * time.Millisecond,
+		CoalesceSaves: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(other, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(other); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-changes2:
+		t.Fatalf("unexpected change: %+v", ev)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestChanges_RemoveGrace(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := Changes(ctx, MultiConfig{
+		TargetFiles:   []string{file},
+		Debounce:      30 * time.Millisecond,
+		CoalesceSaves: true,
+		RemoveGrace:   200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Put back within the grace period: a modification, not a removal.
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-changes:
+		if ev.Op != fsnotify.Write {
+			t.Errorf("Op = %v, want WRITE", ev.Op)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change delivered")
+	}
+
+	// Gone for good: reported once the grace period has passed.
+	removed := time.Now()
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-changes:
+		if ev.Op != fsnotify.Remove {
+			t.Errorf("Op = %v, want REMOVE", ev.Op)
+		}
+		if d := time.Since(removed); d < 200*time.Millisecond {
+			t.Errorf("removal delivered after %s, before the grace period", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("removal not delivered")
+	}
+}
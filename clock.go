@@ -0,0 +1,58 @@
+package reloader
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the time source used for debouncing, retries and every other
+// delay in this package. The default is the real clock; tests can substitute
+// a fake one (see the reloadertest package) to simulate hours of flapping or
+// backoff in milliseconds.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock. C returns nil for timers created by
+// AfterFunc, like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// RealClock is the default Clock, backed by the time package.
+type RealClock struct{}
+
+// Now calls time.Now.
+func (RealClock) Now() time.Time { return time.Now() }
+
+// NewTimer calls time.NewTimer.
+func (RealClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+// AfterFunc calls time.AfterFunc.
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer { return realTimer{time.AfterFunc(d, f)} }
+
+// realTimer adapts *time.Timer to Timer.
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r realTimer) C() <-chan time.Time        { return r.t.C }
+func (r realTimer) Stop() bool                 { return r.t.Stop() }
+func (r realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+// sleep waits for d on clock, returning ctx's error if it is done first.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+// Command reloader supervises a process with the reloader library and
+// controls running watchers through their control socket.
+//
+// Usage:
+//
+//	reloader run [-env FILE] [-socket PATH] [-debounce D] -- PROGRAM [ARGS...]
+//	reloader ctl -socket PATH status|reload|pause|resume|add|remove [PATH]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/blackorder/reloader"
+)
+
+// ctlTimeout bounds how long ctl waits for a command, including reloads.
+const ctlTimeout = time.Minute
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = run(os.Args[2:])
+	case "ctl":
+		err = ctl(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: reloader run [-env FILE] [-socket PATH] [-debounce D] -- PROGRAM [ARGS...]")
+	fmt.Fprintln(os.Stderr, "       reloader ctl -socket PATH status|reload|pause|resume|add|remove [PATH]")
+	os.Exit(2)
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	envFile := fs.String("env", "", "dotenv file merged into the program's environment")
+	socket := fs.String("socket", "", "Unix control socket to listen on")
+	mode := fs.Uint("socket-mode", uint(reloader.DefaultControlMode), "permissions of the control socket")
+	debounce := fs.Duration("debounce", reloader.DefaultDebounce, "wait before restarting on change")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		usage()
+	}
+
+	path, err := exec.LookPath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	if *envFile != "" {
+		if *envFile, err = filepath.Abs(*envFile); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	sup, err := reloader.NewSupervisor(reloader.SupervisorConfig{
+		Path:          path,
+		Args:          fs.Args()[1:],
+		EnvFile:       *envFile,
+		Debounce:      *debounce,
+		ControlSocket: *socket,
+		ControlMode:   os.FileMode(*mode), // #nosec G115 - file modes fit in 32 bits
+		OnEvent:       func(msg string) { log.Println(msg) },
+		OnError:       func(err error) { log.Println("error:", err) },
+	})
+	if err != nil {
+		return err
+	}
+	if err := sup.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func ctl(args []string) error {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := fs.String("socket", os.Getenv("RELOADER_SOCKET"), "Unix control socket (default $RELOADER_SOCKET)")
+	_ = fs.Parse(args)
+	if *socket == "" || fs.NArg() == 0 || fs.NArg() > 2 {
+		usage()
+	}
+
+	req := reloader.ControlRequest{Command: fs.Arg(0)}
+	if fs.NArg() == 2 {
+		path, err := filepath.Abs(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		req.Path = path
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ctlTimeout)
+	defer cancel()
+	resp, err := reloader.SendControl(ctx, *socket, req)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(resp.Status); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package reloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultControlMode is the default permission of a control socket file.
+const DefaultControlMode fs.FileMode = 0o600
+
+// ControlRequest is one line sent to a control socket.
+type ControlRequest struct {
+	Command string `json:"command"`        // status, reload, pause, resume, add or remove
+	Path    string `json:"path,omitempty"` // target of reload (optional), add and remove
+}
+
+// ControlResponse is the line sent back for each ControlRequest.
+type ControlResponse struct {
+	OK     bool    `json:"ok"`
+	Error  string  `json:"error,omitempty"`
+	Status *Status `json:"status,omitempty"` // state after the command
+}
+
+// ControlConfig configures ServeControl.
+type ControlConfig struct {
+	Socket  string       // path of the Unix socket (required)
+	Mode    fs.FileMode  // permissions of the socket file (default 0600)
+	OnEvent func(string) // optional callback for logging
+	OnError func(error)  // optional callback for logging
+}
+
+// ServeControl listens on a Unix socket and drives w with the line-delimited
+// JSON protocol of ControlRequest and ControlResponse until ctx is done. A
+// stale socket file left behind by a previous run is replaced; a socket
+// another process is still serving on is not.
+func ServeControl(ctx context.Context, w *Watcher, cfg ControlConfig) error {
+	if cfg.Socket == "" {
+		return errors.New("Socket must be set")
+	}
+	if cfg.Mode == 0 {
+		cfg.Mode = DefaultControlMode
+	}
+	if err := removeStaleSocket(cfg.Socket); err != nil {
+		return err
+	}
+
+	l, err := listenControl(cfg.Socket, cfg.Mode)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(cfg.Socket)
+	defer l.Close()
+	if cfg.OnEvent != nil {
+		cfg.OnEvent("control socket listening on " + cfg.Socket)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = l.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := serveControlConn(ctx, w, conn); err != nil && cfg.OnError != nil {
+				cfg.OnError(fmt.Errorf("control connection: %w", err))
+			}
+		}()
+	}
+}
+
+// listenControl listens on a Unix socket at socket whose permissions are
+// mode from the start. The socket is created with the umask's permissions,
+// so it is bound inside a private directory, given mode and only then
+// linked into place, leaving no window in which other users can connect.
+// Linking fails rather than replace a socket that appeared meanwhile. The
+// caller removes socket once done.
+func listenControl(socket string, mode fs.FileMode) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(socket), ".ctl") // created 0700
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// Closing must not unlink tmp, which dir's removal takes care of.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	if err := os.Link(tmp, socket); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// SendControl sends req to the control socket at socket and returns the
+// response. A response reporting a failed command is not an error.
+func SendControl(ctx context.Context, socket string, req ControlRequest) (ControlResponse, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return ControlResponse{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return ControlResponse{}, err
+	}
+	var resp ControlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			return ControlResponse{}, ctx.Err()
+		}
+		return ControlResponse{}, err
+	}
+	return resp, nil
+}
+
+func serveControlConn(ctx context.Context, w *Watcher, conn net.Conn) error {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req ControlRequest
+		resp := ControlResponse{OK: true}
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		if err == nil {
+			err = runControl(ctx, w, req)
+		}
+		if err != nil {
+			resp = ControlResponse{Error: err.Error()}
+		}
+		st := w.Status()
+		resp.Status = &st
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+func runControl(ctx context.Context, w *Watcher, req ControlRequest) error {
+	switch req.Command {
+	case "status":
+		return nil
+	case "reload":
+		return w.Reload(ctx, req.Path)
+	case "pause":
+		return w.Pause(ctx)
+	case "resume":
+		return w.Resume(ctx)
+	case "add", "remove":
+		if req.Path == "" {
+			return fmt.Errorf("%s requires a path", req.Command)
+		}
+		if req.Command == "add" {
+			return w.Add(ctx, req.Path)
+		}
+		return w.Remove(ctx, req.Path)
+	default:
+		return fmt.Errorf("unknown command %q", req.Command)
+	}
+}
+
+// removeStaleSocket removes a socket file nobody is listening on.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,105 @@
+package reloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestServeControl(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket permissions are not supported")
+	}
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	socket := filepath.Join(dir, "ctl.sock")
+
+	reloaded := make(chan string, 10)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{a},
+		OnChange:    func(path string) { reloaded <- path },
+		Debounce:    20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeControl(ctx, w, ControlConfig{Socket: socket, Mode: 0o660})
+	}()
+	waitFor(t, func() bool { _, err := os.Stat(socket); return err == nil })
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o660 {
+		t.Errorf("socket mode = %v, want 0660", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the socket in %s, got %v", dir, entries)
+	}
+
+	send := func(req ControlRequest) ControlResponse {
+		t.Helper()
+		resp, err := SendControl(ctx, socket, req)
+		if err != nil {
+			t.Fatalf("%s: %v", req.Command, err)
+		}
+		return resp
+	}
+
+	if resp := send(ControlRequest{Command: "add", Path: b}); !resp.OK || len(resp.Status.Targets) != 2 {
+		t.Fatalf("add: %+v", resp)
+	}
+	if resp := send(ControlRequest{Command: "pause"}); !resp.OK || !resp.Status.Paused {
+		t.Fatalf("pause: %+v", resp)
+	}
+	if err := os.WriteFile(b, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return w.Status().Targets[1].Held })
+	if len(reloaded) != 0 {
+		t.Fatal("change delivered while paused")
+	}
+	if resp := send(ControlRequest{Command: "resume"}); !resp.OK || resp.Status.Paused {
+		t.Fatalf("resume: %+v", resp)
+	}
+	if got := <-reloaded; got != b {
+		t.Errorf("reloaded %q on resume, want %q", got, b)
+	}
+
+	if resp := send(ControlRequest{Command: "reload", Path: a}); !resp.OK {
+		t.Fatalf("reload: %+v", resp)
+	}
+	if got := <-reloaded; got != a {
+		t.Errorf("reloaded %q, want %q", got, a)
+	}
+	if resp := send(ControlRequest{Command: "remove", Path: b}); !resp.OK || len(resp.Status.Targets) != 1 {
+		t.Fatalf("remove: %+v", resp)
+	}
+	if resp := send(ControlRequest{Command: "remove", Path: b}); resp.OK || resp.Error == "" {
+		t.Errorf("second remove should fail: %+v", resp)
+	}
+	if resp := send(ControlRequest{Command: "bogus"}); resp.OK {
+		t.Errorf("unknown command should fail: %+v", resp)
+	}
+
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("ServeControl did not return after cancellation")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket file not removed: %v", err)
+	}
+}
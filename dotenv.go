@@ -0,0 +1,153 @@
+package reloader
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var errUnterminatedQuote = errors.New("unterminated quoted value")
+
+// ParseEnv parses dotenv formatted content. It supports blank lines, "#"
+// comments, an optional "export " prefix, unquoted values with trailing
+// " #" comments, single-quoted values taken literally and double-quoted
+// values with \n, \t, \" and \\ escapes.
+func ParseEnv(r io.Reader) (map[string]string, error) {
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// ReadEnvFile parses the dotenv file at path.
+func ReadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path) // #nosec G304 - path is provided by the caller
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env, err := ParseEnv(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return env, nil
+}
+
+// MergeEnv returns base (in os.Environ form) with every key in overrides
+// set to its override value.
+func MergeEnv(base []string, overrides map[string]string) []string {
+	merged := make([]string, 0, len(base)+len(overrides))
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := overrides[key]; !ok {
+			merged = append(merged, kv)
+		}
+	}
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		merged = append(merged, key+"="+overrides[key])
+	}
+	return merged
+}
+
+// DiffEnv returns the sorted keys that were added, removed or changed
+// between old and updated.
+func DiffEnv(old, updated map[string]string) []string {
+	var changed []string
+	for key, value := range updated {
+		if prev, ok := old[key]; !ok || prev != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range old {
+		if _, ok := updated[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// redactedKeys formats changed keys for logging without leaking values.
+func redactedKeys(keys []string) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=<redacted>"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func parseEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch quote := raw[0]; quote {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", errUnterminatedQuote
+		}
+		return raw[1 : end+1], nil
+
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(raw[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", errUnterminatedQuote
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
@@ -0,0 +1,82 @@
+package reloader
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "plain values and comments",
+			input: "# comment\n\nFOO=bar\nEMPTY=\nSPACED = value with spaces  # trailing\n",
+			want:  map[string]string{"FOO": "bar", "EMPTY": "", "SPACED": "value with spaces"},
+		},
+		{
+			name:  "export prefix",
+			input: "export TOKEN=abc\n",
+			want:  map[string]string{"TOKEN": "abc"},
+		},
+		{
+			name:  "quoted values",
+			input: `SINGLE='a #not comment\n'` + "\n" + `DOUBLE="line1\nline2 \"q\""` + "\n",
+			want:  map[string]string{"SINGLE": `a #not comment\n`, "DOUBLE": "line1\nline2 \"q\""},
+		},
+		{
+			name:  "hash inside unquoted value",
+			input: "URL=http://host/#anchor\n",
+			want:  map[string]string{"URL": "http://host/#anchor"},
+		},
+		{
+			name:    "missing equals",
+			input:   "NOT_A_PAIR\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated quote",
+			input:   `KEY="oops` + "\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnv(strings.NewReader(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeAndDiffEnv(t *testing.T) {
+	merged := MergeEnv([]string{"PATH=/bin", "FOO=old"}, map[string]string{"FOO": "new", "BAR": "1"})
+	want := []string{"PATH=/bin", "BAR=1", "FOO=new"}
+	if !slices.Equal(merged, want) {
+		t.Errorf("Expected %v, got %v", want, merged)
+	}
+
+	changed := DiffEnv(
+		map[string]string{"KEEP": "1", "CHANGE": "a", "DROP": "x"},
+		map[string]string{"KEEP": "1", "CHANGE": "b", "ADD": "y"},
+	)
+	if want := []string{"ADD", "CHANGE", "DROP"}; !slices.Equal(changed, want) {
+		t.Errorf("Expected %v, got %v", want, changed)
+	}
+}
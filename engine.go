@@ -0,0 +1,1019 @@
+package reloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// engine is the event loop shared by Watch and WatchMultiple. It watches the
+// directory of every target, debounces changes per target and keeps a
+// snapshot of every target so that changes lost to a queue overflow or a
+// watcher recreation are detected by rescanning.
+//
+// Targets are tracked independently: if a target's directory does not exist
+// yet, its nearest existing ancestor is watched instead and the watch walks
+// down as the missing directories are created.
+type engine struct {
+	targets         []*target
+	debounce        time.Duration
+	retryDelay      time.Duration
+	retry           RetryPolicy
+	backend         Backend
+	clock           Clock
+	onChange        func(context.Context, ChangeEvent) error // nil if only opCallbacks are set
+	opCallbacks     opCallbacks
+	middleware      []Middleware // wraps invoke as wrapped once run starts
+	wrapped         Handler
+	callbackTimeout time.Duration          // 0 if callbacks may run forever
+	actions         *actionGraph           // run instead of onChange if set
+	ops             fsnotify.Op            // operations that trigger a change, 0 for DefaultOps
+	targetOps       map[string]fsnotify.Op // per-target overrides of ops
+	onEvent         func(string)
+	onError         func(error)
+	signals         []os.Signal // signals that trigger a change of every target
+	metrics         *Metrics    // nil if not collected
+	journal         *Journal    // nil if not recorded
+	stateFile       string      // "" if digests are not kept between runs
+	stateReportOnly bool        // report changes found in stateFile instead of delivering them
+	fireOnStart     bool        // deliver every existing target once the first watches are set up
+	onMissing       func(string)
+	coalesce        bool          // deliver atomic-save bursts as a single operation
+	removeGrace     time.Duration // how long a removed target must stay absent before delivery
+	single          bool          // Watch-style log messages
+
+	started  bool                    // whether the initial snapshot was taken
+	healthy  bool                    // whether an event source is open
+	lastErr  error                   // last error passed to onError
+	watches  map[string]int          // watched directory -> number of targets using it
+	counted  int                     // len(watches) as last added to metrics
+	saved    map[string]targetRecord // stateFile contents
+	attaches chan *target            // targets whose attach retry delay elapsed
+	requests chan request            // calls from other goroutines, see Watcher
+	done     chan struct{}           // closed when run returns
+	paused   bool                    // hold debounced changes instead of delivering them
+	held     []string                // changes held while paused, in order
+	baseline map[string]string       // digest of each settled target when paused
+
+	mu        sync.Mutex // guards timers, deadlines and published
+	timers    map[string]*debounceTimer
+	deadlines map[string]time.Time // when each pending timer fires
+	published Status               // loop state as of the last publish
+	debounced chan *debounceTimer
+}
+
+// debounceTimer is a debounce timer of path. It stays pending until the
+// loop receives it, so that stopping it while it fires still drops it.
+type debounceTimer struct {
+	Timer
+	path    string
+	stopped bool // guarded by engine.mu
+}
+
+// request runs fn on the loop goroutine, which owns the targets.
+type request struct {
+	fn   func(ctx context.Context, w EventSource) error
+	done chan error
+}
+
+// target is the per-file state of an engine.
+type target struct {
+	path  string
+	dir   string    // directory currently watched for path, "" if none
+	state fileState // last observed state
+	retry *backoff  // consecutive failures to attach
+	timer Timer     // pending attach retry
+	err   error     // set once retries are exhausted
+
+	ops     fsnotify.Op // operations seen in the current debounce window
+	changed time.Time   // when the last of them was seen
+	source  string      // what triggered the pending change, see ChangeEvent.Source
+	existed bool        // whether the file existed when the pending change began
+	graced  bool        // whether the pending removal already waited for removeGrace
+	status  TargetStatus
+}
+
+// fileState is what the engine remembers about a target between events.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	inode   uint64
+}
+
+func (s fileState) equal(o fileState) bool {
+	return s.exists == o.exists && s.size == o.size && s.inode == o.inode && s.modTime.Equal(o.modTime)
+}
+
+func (e *engine) stat(path string) fileState {
+	info, err := e.backend.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime(), inode: fileInode(info)}
+}
+
+// digest returns the hex SHA-256 of path's content, or "" if it does not
+// exist.
+func (e *engine) digest(path string) (string, error) {
+	return digestFile(e.backend, path)
+}
+
+// digestFile returns the hex SHA-256 of path's content read through b, or ""
+// if it does not exist.
+func digestFile(b Backend, path string) (string, error) {
+	f, err := b.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func newEngine(paths []string, debounce, retryDelay time.Duration) *engine {
+	targets := make([]*target, len(paths))
+	for i, path := range paths {
+		targets[i] = &target{path: path, status: TargetStatus{Path: path}}
+	}
+	return &engine{
+		targets:    targets,
+		debounce:   debounce,
+		retryDelay: retryDelay,
+		backend:    OSBackend{},
+		clock:      RealClock{},
+		attaches:   make(chan *target),
+		requests:   make(chan request),
+		done:       make(chan struct{}),
+		timers:     make(map[string]*debounceTimer),
+		deadlines:  make(map[string]time.Time),
+		debounced:  make(chan *debounceTimer),
+	}
+}
+
+// setBackend overrides the default backend and clock when they are set.
+func (e *engine) setBackend(backend Backend, clock Clock) {
+	if backend != nil {
+		e.backend = backend
+	}
+	if clock != nil {
+		e.clock = clock
+	}
+}
+
+// run blocks until ctx is done, recreating the watcher whenever it fails,
+// or until the retry policy gives up. Pending debounce timers survive
+// recreation.
+func (e *engine) run(ctx context.Context) error {
+	defer close(e.done)
+	defer e.stopTimers()
+
+	e.wrapped = Use(HandlerFunc(e.invoke), e.middleware...)
+	ctx = withEnv(ctx, e.backend, e.clock)
+
+	if !e.single {
+		dirs := make(map[string]bool)
+		for _, t := range e.targets {
+			dirs[filepath.Dir(t.path)] = true
+		}
+		e.event(fmt.Sprintf("watching %d files across %d directories", len(e.targets), len(dirs)))
+	}
+
+	var sigs chan os.Signal
+	if len(e.signals) > 0 {
+		sigs = make(chan os.Signal, 1)
+		signal.Notify(sigs, e.signals...)
+		defer signal.Stop(sigs)
+	}
+
+	retry := newBackoff(e.retryDelay, e.retry, e.clock)
+	for {
+		w, err := e.backend.NewEventSource()
+		if err != nil {
+			e.healthy = false
+			e.reportError(err)
+			e.publish()
+			delay, err := retry.next(err)
+			if err != nil {
+				return err
+			}
+			e.metrics.retried()
+			if err := sleep(ctx, e.clock, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		retry.reset()
+		e.healthy = true
+
+		first := !e.started
+		if first {
+			e.snapshot()
+			if e.stateFile != "" {
+				e.loadState(ctx)
+			}
+			e.started = true
+		}
+
+		e.watches = make(map[string]int)
+		for _, t := range e.targets {
+			t.dir = ""
+			t.retry = newBackoff(e.retryDelay, e.retry, e.clock)
+			t.err = nil
+			e.attach(ctx, w, t)
+		}
+
+		err = e.allGaveUp()
+		if err == nil {
+			if first && e.fireOnStart {
+				e.fire(ctx)
+			}
+			err = e.loop(ctx, w, sigs)
+		}
+		e.stopAttachRetries()
+		_ = w.Close()
+		e.watches = nil
+		e.healthy = false
+		e.publish()
+		if err != nil {
+			return err
+		}
+		e.metrics.recreated()
+	}
+}
+
+// loop handles events until ctx is done (returning its error), every
+// target has given up (returning an error) or the watcher has to be
+// recreated (returning nil).
+func (e *engine) loop(ctx context.Context, w EventSource, sigs <-chan os.Signal) error {
+	for {
+		e.publish()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case ev, ok := <-w.Events():
+			if !ok {
+				return nil
+			}
+			e.metrics.event(ev.Op)
+			e.handle(ctx, w, ev)
+
+		case sig := <-sigs:
+			source := "signal:" + signalName(sig)
+			e.event("signal received: " + signalName(sig))
+			for _, t := range e.targets {
+				e.record(t, 0, source)
+				e.schedule(ctx, t.path)
+			}
+
+		case t := <-e.attaches:
+			if !slices.Contains(e.targets, t) {
+				continue // removed while the retry was pending
+			}
+			t.timer = nil
+			e.attach(ctx, w, t)
+			if err := e.allGaveUp(); err != nil {
+				return err
+			}
+
+		case timer := <-e.debounced:
+			file := timer.path
+			if !e.fired(timer) {
+				continue // stopped or restarted while firing
+			}
+			if !slices.ContainsFunc(e.targets, func(t *target) bool { return t.path == file }) {
+				continue // removed while the timer was firing
+			}
+			e.metrics.debounceFired()
+			if !e.settled(ctx, file) {
+				continue
+			}
+			e.journalChange(JournalChange, e.change(file), "")
+			if e.single {
+				e.event("sending signal")
+			} else {
+				e.event("sending signal for: " + file)
+			}
+			if e.paused {
+				if !slices.Contains(e.held, file) {
+					e.held = append(e.held, file)
+				}
+				e.event("paused, holding change: " + file)
+				e.journalChange(JournalSuppressed, e.change(file), "paused")
+				continue
+			}
+			if e.actions != nil {
+				_ = e.deliverAll(ctx, e.batch(ctx, file))
+				continue
+			}
+			_ = e.deliver(ctx, file)
+
+		case req := <-e.requests:
+			req.done <- req.fn(ctx, w)
+
+		case err, ok := <-w.Errors():
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// The watch itself is intact; only events were dropped.
+				e.reportError(err)
+				e.rescan(ctx)
+				continue
+			}
+			if err != nil {
+				e.reportError(err)
+			}
+			return nil // recreate watcher
+		}
+	}
+}
+
+// handle dispatches a single filesystem event.
+func (e *engine) handle(ctx context.Context, w EventSource, ev fsnotify.Event) {
+	if (ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)) && e.watches[ev.Name] > 0 {
+		// The kernel drops the watch together with the directory.
+		delete(e.watches, ev.Name)
+		for _, t := range e.targets {
+			if t.dir == ev.Name {
+				t.dir = ""
+			}
+		}
+	}
+
+	for _, t := range e.targets {
+		switch {
+		case ev.Name == t.path:
+			op := ev.Op & e.mask(t.path)
+			if op == 0 {
+				continue
+			}
+			e.event("change detected: " + ev.String())
+			e.record(t, op, "file:"+t.path)
+			t.state = e.stat(t.path)
+			e.schedule(ctx, t.path)
+
+		case ev.Op&DefaultOps != 0 && strings.HasPrefix(t.path, ev.Name+string(filepath.Separator)) &&
+			t.err == nil && t.timer == nil:
+			// A directory on the way to the target appeared or went away.
+			e.attach(ctx, w, t)
+		}
+	}
+}
+
+// attach watches the nearest existing ancestor of t's directory. If the
+// target's own directory is (now) watched, t is checked for changes that
+// happened while it was not. Failures are retried with t's own backoff so
+// they never hold up other targets.
+func (e *engine) attach(ctx context.Context, w EventSource, t *target) {
+	dir, err := e.existingAncestor(filepath.Dir(t.path))
+	if err == nil && dir != t.dir && e.watches[dir] == 0 {
+		err = w.Add(dir)
+	}
+	if err != nil {
+		e.detach(w, t)
+		err = fmt.Errorf("failed to watch directory %s: %w", filepath.Dir(t.path), err)
+		delay, exhausted := t.retry.next(err)
+		if exhausted != nil {
+			t.err = fmt.Errorf("giving up on %s: %w", t.path, exhausted)
+			e.reportError(t.err)
+			return
+		}
+		e.reportError(err)
+		e.metrics.retried()
+		t.timer = e.clock.AfterFunc(delay, func() {
+			select {
+			case e.attaches <- t:
+			case <-ctx.Done():
+			}
+		})
+		return
+	}
+	t.retry.reset()
+
+	if dir != t.dir {
+		e.detach(w, t)
+		added := e.watches[dir] == 0
+		e.watches[dir]++
+		t.dir = dir
+		switch {
+		case dir != filepath.Dir(t.path):
+			e.event(fmt.Sprintf("waiting for %s: watching %s", filepath.Dir(t.path), dir))
+		case !added:
+			// Another target already watches dir.
+		case e.single:
+			e.event("watching " + dir)
+		default:
+			e.event("watching directory: " + dir)
+		}
+	}
+	if dir == filepath.Dir(t.path) {
+		e.check(ctx, t, "change detected while not watching: ")
+	}
+}
+
+// detach releases t's current directory watch.
+func (e *engine) detach(w EventSource, t *target) {
+	if t.dir == "" {
+		return
+	}
+	if e.watches[t.dir]--; e.watches[t.dir] <= 0 {
+		delete(e.watches, t.dir)
+		_ = w.Remove(t.dir)
+	}
+	t.dir = ""
+}
+
+// allGaveUp returns the joined errors of all targets once every one of them
+// has exhausted its retries, and nil otherwise.
+func (e *engine) allGaveUp() error {
+	errs := make([]error, 0, len(e.targets))
+	for _, t := range e.targets {
+		if t.err == nil {
+			return nil
+		}
+		errs = append(errs, t.err)
+	}
+	return errors.Join(errs...)
+}
+
+// snapshot records the current state of every target.
+func (e *engine) snapshot() {
+	for _, t := range e.targets {
+		t.state = e.stat(t.path)
+	}
+}
+
+// fire delivers every existing target once, as if it had just been
+// created, and reports the others as missing. The watches are already in
+// place, so a change made while a callback runs is not lost.
+func (e *engine) fire(ctx context.Context) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, t := range e.targets {
+		if seen[t.path] {
+			continue
+		}
+		seen[t.path] = true
+		if !t.state.exists {
+			e.event("target does not exist yet: " + t.path)
+			if e.onMissing != nil {
+				e.onMissing(t.path)
+			}
+			continue
+		}
+		e.record(t, fsnotify.Create, "start")
+		files = append(files, t.path)
+	}
+	_ = e.deliverEach(ctx, files)
+}
+
+// rescan compares every target against the snapshot and schedules a change
+// for each one that differs, covering events that were never delivered.
+func (e *engine) rescan(ctx context.Context) {
+	for _, t := range e.targets {
+		e.check(ctx, t, "change detected by rescan: ")
+	}
+}
+
+// check schedules a change for t if it differs from the snapshot.
+func (e *engine) check(ctx context.Context, t *target, reason string) {
+	current := e.stat(t.path)
+	if current.equal(t.state) {
+		return
+	}
+	op := fsnotify.Write
+	switch {
+	case !t.state.exists:
+		op = fsnotify.Create
+	case !current.exists:
+		op = fsnotify.Remove
+	}
+	if op&e.mask(t.path) == 0 {
+		t.state = current
+		return
+	}
+	e.event(reason + t.path)
+	e.record(t, op, "file:"+t.path)
+	t.state = current
+	e.schedule(ctx, t.path)
+}
+
+// record adds op to t's pending change, triggered by source. It must be
+// called before t.state is updated, so the first call of a change can note
+// whether the file existed before it.
+func (e *engine) record(t *target, op fsnotify.Op, source string) {
+	if t.ops == 0 {
+		t.existed = t.state.exists
+	}
+	t.graced = false
+	t.ops |= op
+	t.source = source
+	t.changed = e.clock.Now()
+	t.status.LastChange = t.changed
+}
+
+// deliver hands the pending change of every target at path to onChange and
+// records the result. Errors are reported and returned.
+func (e *engine) deliver(ctx context.Context, path string) error {
+	return e.deliverAll(ctx, []string{path})
+}
+
+// deliverEach delivers paths as one batch if actions are set, and one after
+// the other otherwise. Errors are reported and returned.
+func (e *engine) deliverEach(ctx context.Context, paths []string) error {
+	if e.actions != nil {
+		if len(paths) == 0 {
+			return nil
+		}
+		return e.deliverAll(ctx, paths)
+	}
+	var errs []error
+	for _, path := range paths {
+		errs = append(errs, e.deliver(ctx, path))
+	}
+	return errors.Join(errs...)
+}
+
+// deliverAll hands the pending changes of paths to the actions as one
+// batch, or to onChange one after the other, and records the results.
+// Errors are reported and returned.
+func (e *engine) deliverAll(ctx context.Context, paths []string) error {
+	evs := make([]ChangeEvent, len(paths))
+	digests := make([]string, len(paths))
+	for i, path := range paths {
+		evs[i] = e.change(path)
+		e.discard(path)
+		digests[i] = e.journalChange(JournalCallbackStart, evs[i], "")
+	}
+
+	errs := make([]error, len(evs))
+	durations := make([]time.Duration, len(evs))
+	if e.actions != nil {
+		start := e.clock.Now()
+		errs = e.runActions(ctx, evs)
+		for i := range durations {
+			durations[i] = e.clock.Now().Sub(start)
+		}
+	} else {
+		for i, ev := range evs {
+			start := e.clock.Now()
+			errs[i] = e.call(ctx, ev)
+			durations[i] = e.clock.Now().Sub(start)
+		}
+	}
+
+	for i, ev := range evs {
+		errs[i] = e.delivered(ev, digests[i], durations[i], errs[i])
+	}
+	return errors.Join(errs...)
+}
+
+// delivered records the result of delivering ev and returns err wrapped
+// with the path, after reporting it.
+func (e *engine) delivered(ev ChangeEvent, digest string, d time.Duration, err error) error {
+	e.metrics.callback(d, err)
+	if e.journal != nil {
+		entry := journalEntry(JournalCallbackEnd, ev, digest)
+		entry.Duration = d
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		e.writeJournal(entry)
+	}
+	if err != nil {
+		err = fmt.Errorf("reload of %s failed: %w", ev.Path, err)
+		e.reportError(err)
+	} else {
+		e.stateDelivered(ev.Path)
+	}
+	for _, t := range e.targets {
+		if t.path == ev.Path {
+			t.status.LastReload = e.clock.Now()
+			t.status.Reloads++
+			t.status.ReloadError = ""
+			if err != nil {
+				t.status.ReloadError = err.Error()
+			}
+		}
+	}
+	return err
+}
+
+// call hands ev to the callbacks through the middleware. A panic is
+// returned as a *PanicError, and with callbackTimeout a callback that runs
+// too long is left behind with its context cancelled.
+func (e *engine) call(ctx context.Context, ev ChangeEvent) error {
+	if e.callbackTimeout > 0 {
+		return callWithTimeout(ctx, e.wrapped, ev, e.callbackTimeout)
+	}
+	return protect(ctx, e.wrapped, ev)
+}
+
+// invoke hands ev to onChange and then to the callbacks of its operations.
+func (e *engine) invoke(ctx context.Context, ev ChangeEvent) error {
+	var err error
+	if e.onChange != nil {
+		err = e.onChange(ctx, ev)
+	}
+	e.dispatch(ev)
+	return err
+}
+
+// change returns the event pending for path: the union of the operations
+// of every target at path, and the time and source of the latest one.
+func (e *engine) change(path string) ChangeEvent {
+	ev := ChangeEvent{Path: path}
+	for _, t := range e.targets {
+		if t.path == path {
+			ev.Op |= t.ops
+			if t.changed.After(ev.Time) {
+				ev.Time = t.changed
+				ev.Source = t.source
+			}
+		}
+	}
+	if e.coalesce && strings.HasPrefix(ev.Source, "file:") && ev.Op&DefaultOps != 0 {
+		ev.Op = (e.coalesced(path) | ev.Op&fsnotify.Chmod) & e.mask(path)
+	}
+	return ev
+}
+
+// coalesced reduces the operations of a file change to the one that
+// describes its outcome, so that an atomic save (write a temporary file,
+// rename it over the target) is a single Write rather than a burst of
+// Rename, Remove and Create. It is 0 if the file was created and removed
+// again.
+func (e *engine) coalesced(path string) fsnotify.Op {
+	existed := slices.ContainsFunc(e.targets, func(t *target) bool { return t.path == path && t.existed })
+	exists := e.stat(path).exists
+	switch {
+	case existed && exists:
+		return fsnotify.Write
+	case exists:
+		return fsnotify.Create
+	case existed:
+		return fsnotify.Remove
+	}
+	return 0
+}
+
+// settled reports whether the debounced change of path should be delivered
+// now. A file change that left path absent waits another removeGrace in
+// case the file is put back, and with coalesce a change that comes down to
+// nothing, such as a file created and removed again, is dropped.
+func (e *engine) settled(ctx context.Context, path string) bool {
+	i := slices.IndexFunc(e.targets, func(t *target) bool { return t.path == path })
+	t := e.targets[i]
+	if !strings.HasPrefix(t.source, "file:") {
+		return true
+	}
+	if t.existed && e.removeGrace > 0 && !t.graced && !e.stat(path).exists {
+		for _, t := range e.targets {
+			if t.path == path {
+				t.graced = true
+			}
+		}
+		e.event(fmt.Sprintf("target removed, waiting %s before reporting: %s", e.removeGrace, path))
+		e.scheduleAfter(ctx, path, e.removeGrace)
+		return false
+	}
+	if e.coalesce && e.change(path).Op == 0 {
+		e.event("nothing left to deliver after coalescing: " + path)
+		e.discard(path)
+		return false
+	}
+	return true
+}
+
+// reload delivers path, or every target if path is empty, without waiting
+// for the debounce delay.
+func (e *engine) reload(ctx context.Context, path string) error {
+	var files []string
+	for _, t := range e.targets {
+		if path != "" && t.path != path || slices.Contains(files, t.path) {
+			continue
+		}
+		files = append(files, t.path)
+		e.cancel(t.path)
+		e.event("manual reload: " + t.path)
+		e.record(t, 0, "manual")
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownTarget, path)
+	}
+	return e.deliverEach(ctx, files)
+}
+
+// pause holds debounced changes until resume. The content of every target
+// without a pending change is recorded so that resume can tell whether it
+// really changed.
+func (e *engine) pause() {
+	if e.paused {
+		return
+	}
+	e.paused = true
+	e.baseline = make(map[string]string)
+	for _, t := range e.targets {
+		if e.pending(t.path) {
+			continue // the callback has not seen this content yet
+		}
+		if sum, err := e.digest(t.path); err == nil {
+			e.baseline[t.path] = sum
+		}
+	}
+	e.event("paused")
+}
+
+// resume delivers one change for every target that changed while paused,
+// skipping those whose content is back to what it was when paused.
+func (e *engine) resume(ctx context.Context) error {
+	if !e.paused {
+		return nil
+	}
+	e.paused = false
+	e.event("resumed")
+
+	held, baseline := e.held, e.baseline
+	e.held, e.baseline = nil, nil
+	var files []string
+	for _, file := range held {
+		if before, ok := baseline[file]; ok {
+			if after, err := e.digest(file); err == nil && after == before {
+				e.event("content unchanged since pause, not reloading: " + file)
+				e.journalChange(JournalSuppressed, e.change(file), "content unchanged since pause")
+				e.discard(file)
+				continue
+			}
+		}
+		files = append(files, file)
+	}
+	return e.deliverEach(ctx, files)
+}
+
+// discard drops the operations recorded for path without delivering them.
+func (e *engine) discard(path string) {
+	for _, t := range e.targets {
+		if t.path == path {
+			t.ops = 0
+		}
+	}
+}
+
+// add starts watching path. Failures to watch its directory are retried in
+// the background like for any other target.
+func (e *engine) add(ctx context.Context, w EventSource, path string) error {
+	if slices.ContainsFunc(e.targets, func(t *target) bool { return t.path == path }) {
+		return fmt.Errorf("%s is already watched", path)
+	}
+	t := &target{
+		path:   path,
+		state:  e.stat(path),
+		retry:  newBackoff(e.retryDelay, e.retry, e.clock),
+		status: TargetStatus{Path: path},
+	}
+	e.targets = append(e.targets, t)
+	e.event("added target: " + path)
+	e.stateDelivered(path)
+	e.attach(ctx, w, t)
+	return nil
+}
+
+// remove stops watching path and drops its pending change, if any.
+func (e *engine) remove(w EventSource, path string) error {
+	i := slices.IndexFunc(e.targets, func(t *target) bool { return t.path == path })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownTarget, path)
+	}
+	t := e.targets[i]
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	e.detach(w, t)
+	e.cancel(path)
+	e.targets = slices.Delete(e.targets, i, i+1)
+	e.held = slices.DeleteFunc(e.held, func(file string) bool { return file == path })
+	delete(e.baseline, path)
+	if e.stateFile != "" {
+		delete(e.saved, path)
+		e.saveState()
+	}
+	e.event("removed target: " + path)
+	return nil
+}
+
+// publish makes the loop's state visible to status and metrics.
+func (e *engine) publish() {
+	e.metrics.addWatchedDirs(len(e.watches) - e.counted)
+	e.counted = len(e.watches)
+
+	st := Status{Healthy: e.healthy, Paused: e.paused, Targets: make([]TargetStatus, len(e.targets))}
+	if e.lastErr != nil {
+		st.Error = e.lastErr.Error()
+	}
+	for i, t := range e.targets {
+		st.Targets[i] = t.status
+		st.Targets[i].Watching = t.dir
+		st.Targets[i].Held = slices.Contains(e.held, t.path)
+		if t.err != nil {
+			st.Targets[i].WatchError = t.err.Error()
+			st.Healthy = false
+		}
+	}
+
+	e.mu.Lock()
+	e.published = st
+	e.mu.Unlock()
+}
+
+// status returns the last published state with the current debounce
+// deadlines. It is safe to call from any goroutine.
+func (e *engine) status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := e.published
+	st.Targets = append([]TargetStatus(nil), st.Targets...)
+	for i := range st.Targets {
+		st.Targets[i].Pending = e.deadlines[st.Targets[i].Path]
+	}
+	return st
+}
+
+// schedule (re)starts the debounce timer for path.
+func (e *engine) schedule(ctx context.Context, path string) {
+	e.scheduleAfter(ctx, path, e.debounce)
+}
+
+// scheduleAfter (re)starts the timer for path with delay d.
+func (e *engine) scheduleAfter(ctx context.Context, path string, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if timer, ok := e.timers[path]; ok {
+		timer.Stop()
+		timer.stopped = true
+	}
+	e.deadlines[path] = e.clock.Now().Add(d)
+	timer := &debounceTimer{path: path}
+	timer.Timer = e.clock.AfterFunc(d, func() {
+		select {
+		case e.debounced <- timer:
+		case <-ctx.Done():
+		}
+	})
+	e.timers[path] = timer
+}
+
+// fired removes timer, which the loop just received, from the pending
+// timers. It returns false if timer was stopped in the meantime.
+func (e *engine) fired(timer *debounceTimer) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if timer.stopped {
+		return false
+	}
+	delete(e.timers, timer.path)
+	delete(e.deadlines, timer.path)
+	return true
+}
+
+// pending reports whether a debounce timer is running for path.
+func (e *engine) pending(path string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.timers[path]
+	return ok
+}
+
+// cancel stops the debounce timer for path, if any.
+func (e *engine) cancel(path string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if timer, ok := e.timers[path]; ok {
+		timer.Stop()
+		timer.stopped = true
+		delete(e.timers, path)
+		delete(e.deadlines, path)
+	}
+}
+
+func (e *engine) stopAttachRetries() {
+	for _, t := range e.targets {
+		if t.timer != nil {
+			t.timer.Stop()
+			t.timer = nil
+		}
+	}
+}
+
+func (e *engine) stopTimers() {
+	e.stopAttachRetries()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for path, timer := range e.timers {
+		timer.Stop()
+		timer.stopped = true
+		delete(e.timers, path)
+		delete(e.deadlines, path)
+	}
+}
+
+func (e *engine) event(msg string) {
+	if e.onEvent != nil {
+		e.onEvent(msg)
+	}
+}
+
+// signalName returns the conventional name of sig, such as "SIGHUP".
+func signalName(sig os.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return sig.String()
+}
+
+func (e *engine) reportError(err error) {
+	e.lastErr = err
+	e.writeJournal(JournalEntry{Step: JournalError, Error: err.Error()})
+	if e.onError != nil {
+		e.onError(err)
+	}
+}
+
+// existingAncestor returns dir itself or its nearest ancestor that exists.
+// It fails if that path is not a directory.
+func (e *engine) existingAncestor(dir string) (string, error) {
+	for {
+		info, err := e.backend.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return "", &os.PathError{Op: "watch", Path: dir, Err: syscall.ENOTDIR}
+			}
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, os.ErrNotExist) || parent == dir {
+			return "", err
+		}
+		dir = parent
+	}
+}
+
+// journalChange records a step of ev in the journal, with the current digest
+// of ev.Path, and returns that digest.
+func (e *engine) journalChange(step JournalStep, ev ChangeEvent, detail string) string {
+	if e.journal == nil {
+		return ""
+	}
+	digest, _ := e.digest(ev.Path)
+	entry := journalEntry(step, ev, digest)
+	entry.Detail = detail
+	e.writeJournal(entry)
+	return digest
+}
+
+// writeJournal appends entry to the journal, if any. Journal errors go to onError
+// only, so they are not journaled themselves.
+func (e *engine) writeJournal(entry JournalEntry) {
+	if e.journal == nil {
+		return
+	}
+	entry.Time = e.clock.Now()
+	if err := e.journal.Record(entry); err != nil && e.onError != nil {
+		e.onError(fmt.Errorf("journal: %w", err))
+	}
+}
+
+// journalEntry describes ev for the journal.
+func journalEntry(step JournalStep, ev ChangeEvent, digest string) JournalEntry {
+	entry := JournalEntry{Step: step, Path: ev.Path, Digest: digest, Source: ev.Source}
+	if ev.Op != 0 {
+		entry.Op = ev.Op.String()
+	}
+	return entry
+}
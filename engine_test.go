@@ -0,0 +1,54 @@
+package reloader
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEngine_RescanDetectsMissedChanges(t *testing.T) {
+	tempFile := createTempFile(t)
+
+	e := newEngine([]string{tempFile}, 20*time.Millisecond, 10*time.Millisecond)
+	e.snapshot()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer e.stopTimers()
+
+	// Nothing changed: a rescan must not schedule anything.
+	e.rescan(ctx)
+	select {
+	case timer := <-e.debounced:
+		t.Fatalf("Unexpected change for %s", timer.path)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Simulate a write whose event was dropped by an overflow.
+	if err := os.WriteFile(tempFile, []byte("changed while nobody was listening"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	e.rescan(ctx)
+
+	select {
+	case timer := <-e.debounced:
+		if timer.path != tempFile {
+			t.Errorf("Expected change for %s, got %s", tempFile, timer.path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected rescan to synthesize a change")
+	}
+
+	// Removal is a change too.
+	if err := os.Remove(tempFile); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	e.rescan(ctx)
+
+	select {
+	case <-e.debounced:
+	case <-time.After(time.Second):
+		t.Fatal("Expected rescan to detect removal")
+	}
+}
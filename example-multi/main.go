@@ -60,57 +60,61 @@ func main() {
 	// Map to track running processes
 	runningProcesses := make(map[string]*exec.Cmd)
 
-	config := reloader.MultiConfig{
-		TargetFiles: targetFiles,
-		OnChange: func(changedFile string) {
-			log.Printf("🔄 File change detected: %s", changedFile)
-
-			// Determine action based on file extension
-			ext := strings.ToLower(filepath.Ext(changedFile))
-			base := filepath.Base(changedFile)
-
-			switch ext {
-			case extYAML, extYML, extJSON, extTOML, extCONF:
-				log.Printf("📝 Configuration file %s changed, notifying all processes...", base)
-				// In a real scenario, you might reload config for all processes
-				for file, cmd := range runningProcesses {
-					if cmd != nil && cmd.Process != nil {
-						log.Printf("🔄 Sending SIGHUP to process for %s", filepath.Base(file))
-						// Send SIGHUP to the process for graceful config reload
-						if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
-							log.Printf("❌ Failed to send SIGHUP to %s: %v", filepath.Base(file), err)
-						}
-					}
+	// Route configuration files and binaries to their own handlers instead
+	// of switching on the extension of every changed file.
+	router := reloader.NewRouter(reloader.RouterConfig{})
+	defer router.Close()
+	reloadConfig := func(_ context.Context, ev reloader.ChangeEvent) error {
+		log.Printf("📝 Configuration file %s changed, notifying all processes...", filepath.Base(ev.Path))
+		// In a real scenario, you might reload config for all processes
+		for file, cmd := range runningProcesses {
+			if cmd != nil && cmd.Process != nil {
+				log.Printf("🔄 Sending SIGHUP to process for %s", filepath.Base(file))
+				// Send SIGHUP to the process for graceful config reload
+				if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
+					log.Printf("❌ Failed to send SIGHUP to %s: %v", filepath.Base(file), err)
 				}
+			}
+		}
+		return nil
+	}
+	for _, ext := range []string{extYAML, extYML, extJSON, extTOML, extCONF} {
+		router.HandleFunc("*"+anyCase(ext), reloadConfig)
+	}
+	router.HandleFunc("*", func(_ context.Context, ev reloader.ChangeEvent) error {
+		// Restart the specific binary that changed
+		changedFile := ev.Path
+		base := filepath.Base(changedFile)
+		if cmd, exists := runningProcesses[changedFile]; exists && cmd != nil && cmd.Process != nil {
+			log.Printf("⏹️  Stopping process for %s...", base)
+			if err := cmd.Process.Kill(); err != nil {
+				log.Printf("⚠️  Error killing process for %s: %v", base, err)
+			}
+			if err := cmd.Wait(); err != nil {
+				log.Printf("⚠️  Error waiting for process %s: %v", base, err)
+			}
+		}
 
-			default:
-				// Restart the specific binary that changed
-				if cmd, exists := runningProcesses[changedFile]; exists && cmd != nil && cmd.Process != nil {
-					log.Printf("⏹️  Stopping process for %s...", base)
-					if err := cmd.Process.Kill(); err != nil {
-						log.Printf("⚠️  Error killing process for %s: %v", base, err)
-					}
-					if err := cmd.Wait(); err != nil {
-						log.Printf("⚠️  Error waiting for process %s: %v", base, err)
-					}
-				}
+		log.Printf("🚀 Starting new process for %s...", base)
+		// #nosec G204 - This is intentional for a reloader example; file path is validated above
+		newCmd := exec.Command(changedFile)
+		newCmd.Stdout = os.Stdout
+		newCmd.Stderr = os.Stderr
 
-				log.Printf("🚀 Starting new process for %s...", base)
-				newCmd := exec.Command(changedFile)
-				newCmd.Stdout = os.Stdout
-				newCmd.Stderr = os.Stderr
+		if err := newCmd.Start(); err != nil {
+			return fmt.Errorf("failed to start %s: %w", base, err)
+		}
 
-				if err := newCmd.Start(); err != nil {
-					log.Printf("❌ Failed to start %s: %v", base, err)
-					return
-				}
+		runningProcesses[changedFile] = newCmd
+		log.Printf("✅ Process started for %s with PID %d", base, newCmd.Process.Pid)
+		return nil
+	})
 
-				runningProcesses[changedFile] = newCmd
-				log.Printf("✅ Process started for %s with PID %d", base, newCmd.Process.Pid)
-			}
-		},
-		Debounce:   1 * time.Second,
-		RetryDelay: defaultRetryDelaySeconds * time.Second,
+	config := reloader.MultiConfig{
+		TargetFiles: targetFiles,
+		Handler:     router,
+		Debounce:    1 * time.Second,
+		RetryDelay:  defaultRetryDelaySeconds * time.Second,
 		OnEvent: func(msg string) {
 			log.Printf("📡 %s", msg)
 		},
@@ -171,3 +175,19 @@ func main() {
 
 	log.Println("👋 Goodbye!")
 }
+
+// anyCase turns ext into a pattern matching it in any letter case, such as
+// ".[yY][aA][mM][lL]", since filepath.Match is case-sensitive and APP.YAML is
+// as much a configuration file as app.yaml.
+func anyCase(ext string) string {
+	var b strings.Builder
+	for _, r := range ext {
+		lower, upper := strings.ToLower(string(r)), strings.ToUpper(string(r))
+		if lower == upper {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteString("[" + lower + upper + "]")
+	}
+	return b.String()
+}
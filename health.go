@@ -0,0 +1,77 @@
+package reloader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+const (
+	// DefaultHealthTimeout is the default time a restarted child has to become healthy.
+	DefaultHealthTimeout = 30 * time.Second
+	// DefaultHealthInterval is the default time between two health probes.
+	DefaultHealthInterval = time.Second
+)
+
+// HealthCheck probes whether a supervised process is ready. Check returns
+// nil once it is.
+type HealthCheck interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckFunc adapts a function to the HealthCheck interface.
+type HealthCheckFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f HealthCheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HTTPHealthCheck returns a check that passes when a GET of url answers with
+// a 2xx or 3xx status.
+func HTTPHealthCheck(url string) HealthCheck {
+	return HealthCheckFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	})
+}
+
+// TCPHealthCheck returns a check that passes when a TCP connection to addr
+// can be established.
+func TCPHealthCheck(addr string) HealthCheck {
+	return HealthCheckFunc(func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// ExecHealthCheck returns a check that passes when the command exits with
+// status 0.
+func ExecHealthCheck(name string, args ...string) HealthCheck {
+	return HealthCheckFunc(func(ctx context.Context) error {
+		// #nosec G204 - the probe command is chosen by the caller
+		out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", name, err, out)
+		}
+		return nil
+	})
+}
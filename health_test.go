@@ -0,0 +1,202 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthChecks(t *testing.T) {
+	ctx := context.Background()
+
+	ok := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	if err := HTTPHealthCheck(ok.URL).Check(ctx); err != nil {
+		t.Errorf("HTTP check of a healthy server failed: %v", err)
+	}
+	if err := HTTPHealthCheck(failing.URL).Check(ctx); err == nil {
+		t.Error("HTTP check of a 503 passed")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	if err := TCPHealthCheck(addr).Check(ctx); err != nil {
+		t.Errorf("TCP check of a listener failed: %v", err)
+	}
+	l.Close()
+	if err := TCPHealthCheck(addr).Check(ctx); err == nil {
+		t.Error("TCP check of a closed port passed")
+	}
+
+	if runtime.GOOS != "windows" {
+		if err := ExecHealthCheck("true").Check(ctx); err != nil {
+			t.Errorf("exec check of true failed: %v", err)
+		}
+		if err := ExecHealthCheck("false").Check(ctx); err == nil {
+			t.Error("exec check of false passed")
+		}
+	}
+}
+
+func TestSupervisor_RollsBackUnhealthyBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ready")
+	good := "touch " + marker + "\nexec sleep 60\n"
+	bin := writeScript(t, dir, good)
+
+	var mu sync.Mutex
+	var events []string
+	s, err := NewSupervisor(SupervisorConfig{
+		Path: bin,
+		HealthCheck: HealthCheckFunc(func(context.Context) error {
+			_, err := os.Stat(marker)
+			return err
+		}),
+		HealthTimeout:  300 * time.Millisecond,
+		HealthInterval: 10 * time.Millisecond,
+		StopTimeout:    time.Second,
+		Debounce:       50 * time.Millisecond,
+		OnEvent: func(msg string) {
+			mu.Lock()
+			events = append(events, msg)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	backup := bin + ".prev"
+	waitFor(t, func() bool { _, err := os.Stat(backup); return err == nil })
+
+	// Deploy a version that never becomes ready.
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "app.sh.new")
+	if err := os.WriteFile(tmp, []byte("#!/bin/sh\nexec sleep 60\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, bin); err != nil {
+		t.Fatal(err)
+	}
+
+	hasEvent := func(prefix string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, ev := range events {
+			if strings.HasPrefix(ev, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !hasEvent("rollback succeeded") {
+		if time.Now().After(deadline) {
+			mu.Lock()
+			t.Fatalf("no successful rollback, events:\n%s", strings.Join(events, "\n"))
+			mu.Unlock()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	data, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "#!/bin/sh\n"+good {
+		t.Errorf("binary not restored, got %q", data)
+	}
+
+	// The rollback's own write must not trigger another restart.
+	time.Sleep(200 * time.Millisecond)
+	if !hasEvent("binary content unchanged") {
+		t.Error("restored binary was not recognized as unchanged")
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from Run: %v", err)
+	}
+}
+
+func TestSupervisor_HandlesChangesWhileProbing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	starts := filepath.Join(dir, "starts")
+	bin := writeScript(t, dir, "echo x >> "+starts+"\nexec sleep 60\n")
+	countStarts := func() int {
+		data, _ := os.ReadFile(starts)
+		return strings.Count(string(data), "x")
+	}
+
+	s, err := NewSupervisor(SupervisorConfig{
+		Path: bin,
+		HealthCheck: HealthCheckFunc(func(ctx context.Context) error {
+			<-ctx.Done() // never healthy, each check runs until its timeout
+			return ctx.Err()
+		}),
+		HealthTimeout:  time.Minute,
+		HealthInterval: 200 * time.Millisecond,
+		StopTimeout:    time.Second,
+		Debounce:       20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	waitFor(t, func() bool { return countStarts() == 1 && s.Watcher().Status().Healthy })
+
+	// The probe of the first child is still running; a reload must not
+	// wait for it.
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- s.Watcher().Reload(ctx, bin) }()
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("reload while probing: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload waited for the health probe")
+	}
+	waitFor(t, func() bool { return countStarts() == 2 })
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from Run: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package reloader
+
+import "os"
+
+// fileInode is not available on this platform.
+func fileInode(os.FileInfo) uint64 {
+	return 0
+}
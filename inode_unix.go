@@ -0,0 +1,17 @@
+//go:build unix
+
+package reloader
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode number of info, used to notice a file being
+// replaced by another one with the same size and modification time.
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
@@ -0,0 +1,262 @@
+package reloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJournalMaxSize is the default size in bytes at which a journal is rotated.
+	DefaultJournalMaxSize = 10 << 20
+	// DefaultJournalMaxBackups is the default number of rotated journal files kept.
+	DefaultJournalMaxBackups = 3
+)
+
+// JournalStep is the lifecycle step a JournalEntry records.
+type JournalStep string
+
+// Steps written by watchers and supervisors.
+const (
+	JournalChange        JournalStep = "change"         // a debounced change is about to be delivered
+	JournalValidation    JournalStep = "validation"     // result of a health check or application validation
+	JournalCallbackStart JournalStep = "callback_start" // the reload callback was called
+	JournalCallbackEnd   JournalStep = "callback_end"   // the reload callback returned
+	JournalError         JournalStep = "error"          // an error was reported to OnError
+	JournalSuppressed    JournalStep = "suppressed"     // a change was held or skipped instead of reloading
+)
+
+// JournalEntry is one line of a journal.
+type JournalEntry struct {
+	Time     time.Time     `json:"time"`
+	Step     JournalStep   `json:"step"`
+	Path     string        `json:"path,omitempty"`
+	Op       string        `json:"op,omitempty"`      // fsnotify operations, e.g. "WRITE|CREATE"
+	Digest   string        `json:"digest,omitempty"`  // SHA-256 of the file content, hex encoded
+	Source   string        `json:"source,omitempty"`  // trigger source, see ChangeEvent.Source
+	Duration time.Duration `json:"duration,omitzero"` // callback duration in nanoseconds
+	Error    string        `json:"error,omitempty"`
+	Detail   string        `json:"detail,omitempty"`
+}
+
+// JournalConfig configures OpenJournal.
+type JournalConfig struct {
+	Path       string // file to append to (required)
+	MaxSize    int64  // rotate once the file would grow beyond this many bytes (default 10 MiB)
+	MaxBackups int    // rotated files kept as Path.1 (newest) to Path.N (default 3)
+	Sync       bool   // fsync after every entry
+}
+
+// JournalQuery selects entries in ReadJournal. Zero fields match everything.
+type JournalQuery struct {
+	Path  string      // only entries for this file
+	Step  JournalStep // only entries of this step
+	Since time.Time   // only entries at or after this time
+	Until time.Time   // only entries before this time
+	Limit int         // keep only the newest Limit matches
+}
+
+// Journal appends JournalEntry values to a file as JSON Lines, rotating it
+// by size. Set it as the Journal field of a config to record every step of
+// a reload; applications can add their own entries with Record. A nil
+// *Journal discards everything. It is safe for concurrent use.
+type Journal struct {
+	cfg    JournalConfig
+	mu     sync.Mutex
+	f      *os.File // nil if closed or if reopening after a rotation failed
+	size   int64
+	closed bool // Close was called
+}
+
+// OpenJournal opens or creates the journal file and applies defaults.
+func OpenJournal(cfg JournalConfig) (*Journal, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("Path must be set")
+	}
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = DefaultJournalMaxSize
+	}
+	if cfg.MaxBackups == 0 {
+		cfg.MaxBackups = DefaultJournalMaxBackups
+	}
+	j := &Journal{cfg: cfg}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	// #nosec G304 - the journal path is chosen by the caller
+	f, err := os.OpenFile(j.cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	j.f, j.size = f, info.Size()
+	return nil
+}
+
+// Record appends e, setting its Time to now if it is zero.
+func (j *Journal) Record(e JournalEntry) error {
+	if j == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return os.ErrClosed
+	}
+	if j.f == nil {
+		if err := j.open(); err != nil {
+			return err
+		}
+	}
+	// A failed rotation is reported, but the entry is still appended to
+	// the current file and the rotation is tried again next time.
+	var rotateErr error
+	if j.size > 0 && j.size+int64(len(line)) > j.cfg.MaxSize {
+		if err := j.rotate(); err != nil {
+			rotateErr = fmt.Errorf("rotating %s: %w", j.cfg.Path, err)
+			if j.f == nil {
+				return rotateErr
+			}
+		}
+	}
+	n, err := j.f.Write(line)
+	j.size += int64(n)
+	if err == nil && j.cfg.Sync {
+		err = j.f.Sync()
+	}
+	return errors.Join(rotateErr, err)
+}
+
+// rotate closes Path, shifts it into the backups and reopens Path, which is
+// then empty unless the shift failed. Path is reopened either way, so a
+// failed rotation does not end the journal.
+func (j *Journal) rotate() error {
+	err := j.f.Close()
+	j.f = nil
+	if err == nil {
+		err = j.shift()
+	}
+	return errors.Join(err, j.open())
+}
+
+// shift renames Path.N-1 to Path.N, ..., Path to Path.1, dropping the
+// oldest file.
+func (j *Journal) shift() error {
+	for i := j.cfg.MaxBackups; i > 1; i-- {
+		err := os.Rename(j.backupName(i-1), j.backupName(i))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(j.cfg.Path, j.backupName(1))
+}
+
+func (j *Journal) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", j.cfg.Path, i)
+}
+
+// Query reads the entries of this journal and its rotated files that match q.
+func (j *Journal) Query(q JournalQuery) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return readJournal(j.cfg.Path, j.cfg.MaxBackups, q)
+}
+
+// Close closes the journal file. Later Record calls fail.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closed = true
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// ReadJournal returns the entries matching q from the journal at path and
+// up to maxBackups rotated files next to it, oldest first.
+func ReadJournal(path string, maxBackups int, q JournalQuery) ([]JournalEntry, error) {
+	return readJournal(path, maxBackups, q)
+}
+
+func readJournal(path string, maxBackups int, q JournalQuery) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for i := maxBackups; i >= 0; i-- {
+		name := path
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d", path, i)
+		}
+		var err error
+		entries, err = readJournalFile(name, q, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries, nil
+}
+
+// readJournalFile appends the entries of name matching q to entries. A
+// missing file has no entries.
+func readJournalFile(name string, q JournalQuery, entries []JournalEntry) ([]JournalEntry, error) {
+	f, err := os.Open(name) // #nosec G304 - the journal path is chosen by the caller
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		if q.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+func (q JournalQuery) matches(e JournalEntry) bool {
+	return (q.Path == "" || e.Path == q.Path) &&
+		(q.Step == "" || e.Step == q.Step) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until))
+}
@@ -0,0 +1,162 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal_RotatesAndQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	j, err := OpenJournal(JournalConfig{Path: path, MaxSize: 200, MaxBackups: 2, Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 10 {
+		step := JournalChange
+		if i%2 == 1 {
+			step = JournalCallbackEnd
+		}
+		err := j.Record(JournalEntry{Time: start.Add(time.Duration(i) * time.Minute), Step: step, Path: "/etc/app.yaml"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Fatalf("expected two rotated files: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected at most two rotated files, got %v", err)
+	}
+
+	all, err := j.Query(JournalQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 || len(all) >= 10 {
+		t.Fatalf("expected the oldest entries to be dropped, got %d", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if !all[i].Time.After(all[i-1].Time) {
+			t.Fatalf("entries out of order: %v", all)
+		}
+	}
+	if last := all[len(all)-1]; !last.Time.Equal(start.Add(9 * time.Minute)) {
+		t.Errorf("newest entry missing: %+v", last)
+	}
+
+	got, err := ReadJournal(path, 2, JournalQuery{Step: JournalChange, Since: start.Add(5 * time.Minute), Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Time.Equal(start.Add(8*time.Minute)) {
+		t.Errorf("unexpected query result: %+v", got)
+	}
+}
+
+func TestJournal_RecordsReloadSteps(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	j, err := OpenJournal(JournalConfig{Path: filepath.Join(t.TempDir(), "audit.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{file},
+		Debounce:    30 * time.Millisecond,
+		Journal:     j,
+		Handler: HandlerFunc(func(context.Context, ChangeEvent) error {
+			return errors.New("bad config")
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching == dir })
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return w.Status().Targets[0].Reloads == 1 })
+
+	entries, err := j.Query(JournalQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []JournalStep
+	for _, e := range entries {
+		steps = append(steps, e.Step)
+	}
+	want := []JournalStep{JournalChange, JournalCallbackStart, JournalCallbackEnd, JournalError}
+	if len(steps) != len(want) {
+		t.Fatalf("got steps %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Fatalf("got steps %v, want %v", steps, want)
+		}
+	}
+
+	end := entries[2]
+	sum, _ := digestFile(OSBackend{}, file)
+	if end.Path != file || end.Digest != sum || end.Source != "file:"+file || end.Error == "" || end.Op == "" {
+		t.Errorf("incomplete callback_end entry: %+v", end)
+	}
+}
+
+func TestJournal_SurvivesFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	j, err := OpenJournal(JournalConfig{Path: path, MaxSize: 200, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	// A directory in the way of the backup makes the rotation fail.
+	if err := os.Mkdir(path+".1", 0o700); err != nil {
+		t.Fatal(err)
+	}
+	var failures int
+	for range 5 {
+		if err := j.Record(JournalEntry{Step: JournalChange, Path: "/etc/app.yaml"}); err != nil {
+			failures++
+		}
+	}
+	if failures == 0 {
+		t.Fatal("expected the rotation to fail")
+	}
+	got, err := ReadJournal(path, 0, JournalQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 {
+		t.Errorf("expected every entry to be kept in %s, got %d", path, len(got))
+	}
+
+	// Once the cause is gone, the next rotation succeeds.
+	if err := os.Remove(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Record(JournalEntry{Step: JournalChange, Path: "/etc/app.yaml"}); err != nil {
+		t.Fatalf("journal did not recover: %v", err)
+	}
+	if info, err := os.Stat(path + ".1"); err != nil || info.IsDir() {
+		t.Errorf("expected a rotated file, got %v", err)
+	}
+}
@@ -3,10 +3,8 @@ package reloader
 import (
 	"context"
 	"errors"
-	"fmt"
 	"os"
-	"path/filepath"
-	"sync"
+	"slices"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -15,21 +13,41 @@ import (
 const (
 	// DefaultDebounce is the default time to wait before triggering reload after change detection.
 	DefaultDebounce = 3 * time.Second
-	// DefaultRetryDelay is the default time to wait before recreating watcher on errors.
+	// DefaultRetryDelay is the default first wait before recreating watcher on errors.
 	DefaultRetryDelay = 2 * time.Second
 )
 
 // Config lets each binary decide what to watch and how to react.
 type Config struct {
-	OnChange   func()        // callback for reloading the binary
-	OnEvent    func(string)  // optional callback for logging
-	OnError    func(error)   // optional callback for logging
-	TargetFile string        // absolute path to the binary (or any file)
-	Debounce   time.Duration // wait before sending (default 3s)
-	RetryDelay time.Duration // wait before recreating watcher (default 2s)
+	OnChange        func()        // callback for reloading the binary
+	Handler         Handler       // alternative to OnChange that receives the event and can fail
+	Middleware      []Middleware  // wrappers around OnChange or Handler, outermost first
+	CallbackTimeout time.Duration // cancel and report a callback running longer than this (0 = no limit)
+	OnEvent         func(string)  // optional callback for logging
+	OnError         func(error)   // optional callback for logging
+	TargetFile      string        // absolute path to the binary (or any file)
+	Debounce        time.Duration // wait before sending (default 3s)
+	RetryDelay      time.Duration // first wait before recreating watcher, doubled per failure up to 1m unless Retry says otherwise (default 2s)
+	Retry           RetryPolicy   // backoff and give-up limits for recreating the watcher
+	Backend         Backend       // filesystem to observe (default OSBackend)
+	Clock           Clock         // time source for debouncing and retries (default RealClock)
+	Signals         []os.Signal   // signals that trigger a reload like a file change (e.g. SIGHUP)
+	Metrics         *Metrics      // optional registry updated by the watcher
+	Journal         *Journal      // optional audit log of every reload step
+	StateFile       string        // optional file keeping target digests between runs
+	StateReportOnly bool          // only report changes found via StateFile instead of reloading
+	CoalesceSaves   bool          // deliver atomic saves (rename over the file) as one Write instead of every operation, and drop a file created and removed again
+	RemoveGrace     time.Duration // how long a removed file must stay absent before OnChange is called
+	Ops             fsnotify.Op   // operations that trigger a change (default DefaultOps; add fsnotify.Chmod for permission changes)
+	OnCreate        func(string)  // optional callback for a change that created the file
+	OnModify        func(string)  // optional callback for a change that wrote the file
+	OnRemove        func(string)  // optional callback for a change that removed the file
+	OnRename        func(string)  // optional callback for a change that renamed the file away
+	OnChmod         func(string)  // optional callback for a permission change (needs Chmod in Ops)
 }
 
-// Watch blocks until ctx is done.
+// Watch blocks until ctx is done, or until cfg.Retry gives up, in which case
+// the returned error wraps ErrRetriesExhausted and the last failure.
 func Watch(ctx context.Context, cfg Config) error {
 	if cfg.Debounce == 0 {
 		cfg.Debounce = DefaultDebounce
@@ -37,78 +55,40 @@ func Watch(ctx context.Context, cfg Config) error {
 	if cfg.RetryDelay == 0 {
 		cfg.RetryDelay = DefaultRetryDelay
 	}
-	if cfg.OnChange == nil {
+	ops := opCallbacks{cfg.OnCreate, cfg.OnModify, cfg.OnRemove, cfg.OnRename, cfg.OnChmod}
+	switch {
+	case cfg.OnChange == nil && cfg.Handler == nil && !ops.set():
 		return errors.New("OnChange callback must be set")
+	case cfg.OnChange != nil && cfg.Handler != nil:
+		return errors.New("only one of OnChange and Handler can be set")
 	}
 
-	for {
-		w, err := fsnotify.NewWatcher()
-		if err != nil {
-			if cfg.OnError != nil {
-				cfg.OnError(err)
-			}
-			select {
-			case <-time.After(cfg.RetryDelay):
-				continue
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-
-		dir := filepath.Dir(cfg.TargetFile)
-		if err := w.Add(dir); err != nil {
-			if cfg.OnError != nil {
-				cfg.OnError(err)
-			}
-			_ = w.Close()
-			select {
-			case <-time.After(cfg.RetryDelay):
-				continue
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-		if cfg.OnEvent != nil {
-			cfg.OnEvent("watching " + dir)
-		}
-
-		debounce := time.NewTimer(cfg.Debounce)
-		debounce.Stop() // idle
-
-	loop:
-		for {
-			select {
-			case <-ctx.Done():
-				_ = w.Close()
-				return ctx.Err()
-
-			case ev := <-w.Events:
-				if ev.Name == cfg.TargetFile &&
-					(ev.Op&fsnotify.Write != 0 || ev.Op&fsnotify.Create != 0 ||
-						ev.Op&fsnotify.Rename != 0 || ev.Op&fsnotify.Remove != 0) {
-					if cfg.OnEvent != nil {
-						cfg.OnEvent("change detected: " + ev.String())
-					}
-					debounce.Reset(cfg.Debounce)
-				}
-
-			case <-debounce.C:
-				if cfg.OnEvent != nil {
-					cfg.OnEvent("sending signal")
-				}
-				cfg.OnChange() // trigger reload
-
-				debounce.Stop()
-
-			case err := <-w.Errors:
-				if err != nil && cfg.OnError != nil {
-					cfg.OnError(err)
-				}
-				break loop // recreate watcher
-			}
+	e := newEngine([]string{cfg.TargetFile}, cfg.Debounce, cfg.RetryDelay)
+	e.retry = cfg.Retry
+	e.setBackend(cfg.Backend, cfg.Clock)
+	if cfg.Handler != nil {
+		e.onChange = cfg.Handler.HandleChange
+	} else if cfg.OnChange != nil {
+		e.onChange = func(context.Context, ChangeEvent) error {
+			cfg.OnChange()
+			return nil
 		}
-		_ = w.Close()
 	}
+	e.opCallbacks = ops
+	e.middleware = cfg.Middleware
+	e.callbackTimeout = cfg.CallbackTimeout
+	e.ops = cfg.Ops
+	e.onEvent = cfg.OnEvent
+	e.onError = cfg.OnError
+	e.signals = cfg.Signals
+	e.metrics = cfg.Metrics
+	e.journal = cfg.Journal
+	e.stateFile = cfg.StateFile
+	e.stateReportOnly = cfg.StateReportOnly
+	e.coalesce = cfg.CoalesceSaves
+	e.removeGrace = cfg.RemoveGrace
+	e.single = true
+	return e.run(ctx)
 }
 
 // SelfMonitor starts monitoring the current executable and calls the provided
@@ -130,13 +110,44 @@ func SelfMonitor(ctx context.Context, cfg SelfMonitorConfig) error {
 		return err
 	}
 
+	handler := cfg.Handler
+	if cfg.OnReload != nil {
+		if handler != nil {
+			return errors.New("only one of OnReload and Handler can be set")
+		}
+		handler = HandlerFunc(func(context.Context, ChangeEvent) error {
+			cfg.OnReload()
+			return nil
+		})
+	}
+	middleware := cfg.Middleware
+	if cfg.Systemd && handler != nil {
+		clock := cfg.Clock
+		if clock == nil {
+			clock = RealClock{}
+		}
+		if interval := systemdWatchdog(); interval > 0 {
+			go runWatchdog(ctx, clock, interval, cfg.OnError)
+		}
+		middleware = append([]Middleware{systemdReload(clock, cfg.OnError)}, middleware...)
+	}
+
 	config := Config{
-		TargetFile: executable,
-		OnChange:   cfg.OnReload,
-		Debounce:   cfg.Debounce,
-		RetryDelay: cfg.RetryDelay,
-		OnEvent:    cfg.OnEvent,
-		OnError:    cfg.OnError,
+		TargetFile:      executable,
+		Handler:         handler,
+		Middleware:      middleware,
+		CallbackTimeout: cfg.CallbackTimeout,
+		Debounce:        cfg.Debounce,
+		RetryDelay:      cfg.RetryDelay,
+		Retry:           cfg.Retry,
+		Clock:           cfg.Clock,
+		Signals:         cfg.Signals,
+		Metrics:         cfg.Metrics,
+		Journal:         cfg.Journal,
+		StateFile:       cfg.StateFile,
+		StateReportOnly: cfg.StateReportOnly,
+		OnEvent:         cfg.OnEvent,
+		OnError:         cfg.OnError,
 	}
 
 	return Watch(ctx, config)
@@ -144,142 +155,112 @@ func SelfMonitor(ctx context.Context, cfg SelfMonitorConfig) error {
 
 // SelfMonitorConfig provides configuration for the SelfMonitor function.
 type SelfMonitorConfig struct {
-	OnReload   func()        // callback for reloading (required)
-	OnEvent    func(string)  // optional callback for logging
-	OnError    func(error)   // optional callback for logging
-	Debounce   time.Duration // wait before sending (default 3s)
-	RetryDelay time.Duration // wait before recreating watcher (default 2s)
+	OnReload        func()        // callback for reloading (required unless Handler is set)
+	Handler         Handler       // alternative to OnReload that receives the event and can fail
+	Middleware      []Middleware  // wrappers around OnReload or Handler, outermost first
+	CallbackTimeout time.Duration // cancel and report a callback running longer than this (0 = no limit)
+	OnEvent         func(string)  // optional callback for logging
+	OnError         func(error)   // optional callback for logging
+	Debounce        time.Duration // wait before sending (default 3s)
+	RetryDelay      time.Duration // first wait before recreating watcher, doubled per failure up to 1m unless Retry says otherwise (default 2s)
+	Retry           RetryPolicy   // backoff and give-up limits for recreating the watcher
+	Clock           Clock         // time source for debouncing and retries (default RealClock)
+	Signals         []os.Signal   // signals that trigger a reload like a binary change (e.g. SIGHUP)
+	Systemd         bool          // notify $NOTIFY_SOCKET around reloads and send watchdog keepalives
+	Metrics         *Metrics      // optional registry updated by the watcher
+	Journal         *Journal      // optional audit log of every reload step
+	StateFile       string        // optional file keeping target digests between runs
+	StateReportOnly bool          // only report changes found via StateFile instead of reloading
 }
 
 // MultiConfig allows watching multiple files across different directories.
 type MultiConfig struct {
-	OnChange    func(string)  // callback with the file that changed
-	OnEvent     func(string)  // optional callback for logging
-	OnError     func(error)   // optional callback for logging
-	TargetFiles []string      // absolute paths to the files to watch
-	Debounce    time.Duration // wait before sending (default 3s)
-	RetryDelay  time.Duration // wait before recreating watcher (default 2s)
+	OnChange        func(string)           // callback with the file that changed
+	Handler         Handler                // alternative to OnChange that receives the event and can fail
+	OnEvent         func(string)           // optional callback for logging
+	OnError         func(error)            // optional callback for logging
+	TargetFiles     []string               // absolute paths to the files to watch
+	Debounce        time.Duration          // wait before sending (default 3s)
+	RetryDelay      time.Duration          // first wait before recreating watcher, doubled per failure up to 1m unless Retry says otherwise (default 2s)
+	Retry           RetryPolicy            // backoff and give-up limits for recreating the watcher
+	Backend         Backend                // filesystem to observe (default OSBackend)
+	Clock           Clock                  // time source for debouncing and retries (default RealClock)
+	Signals         []os.Signal            // signals that trigger a reload of every file (e.g. SIGHUP)
+	Metrics         *Metrics               // optional registry updated by the watcher
+	Journal         *Journal               // optional audit log of every reload step
+	StateFile       string                 // optional file keeping target digests between runs
+	StateReportOnly bool                   // only report changes found via StateFile instead of reloading
+	FireOnStart     bool                   // deliver every existing file once the watches are established
+	OnMissing       func(string)           // with FireOnStart, called for each file that does not exist yet
+	CoalesceSaves   bool                   // deliver atomic saves (rename over the file) as one Write instead of every operation, and drop a file created and removed again
+	RemoveGrace     time.Duration          // how long a removed file must stay absent before its change is delivered
+	Ops             fsnotify.Op            // operations that trigger a change (default DefaultOps; add fsnotify.Chmod for permission changes)
+	TargetOps       map[string]fsnotify.Op // per-file overrides of Ops
+	Middleware      []Middleware           // wrappers around every delivery, outermost first
+	CallbackTimeout time.Duration          // cancel and report a callback running longer than this (0 = no limit)
+	Actions         []Action               // named reload steps run in dependency order for each batch of changes, instead of OnChange
+	OnCreate        func(string)           // optional callback for a change that created the file
+	OnModify        func(string)           // optional callback for a change that wrote the file
+	OnRemove        func(string)           // optional callback for a change that removed the file
+	OnRename        func(string)           // optional callback for a change that renamed the file away
+	OnChmod         func(string)           // optional callback for a permission change (needs Chmod in Ops)
 }
 
-// WatchMultiple blocks until ctx is done, watching multiple files.
+// WatchMultiple blocks until ctx is done, watching multiple files. Like
+// Watch, it returns an error wrapping ErrRetriesExhausted if cfg.Retry gives
+// up.
 func WatchMultiple(ctx context.Context, cfg MultiConfig) error {
+	w, err := NewWatcher(cfg)
+	if err != nil {
+		return err
+	}
+	return w.Run(ctx)
+}
+
+// newMultiEngine validates cfg and returns an engine for it without an
+// onChange callback.
+func newMultiEngine(cfg MultiConfig) (*engine, error) {
 	if cfg.Debounce == 0 {
 		cfg.Debounce = DefaultDebounce
 	}
 	if cfg.RetryDelay == 0 {
 		cfg.RetryDelay = DefaultRetryDelay
 	}
-	if cfg.OnChange == nil {
-		return errors.New("OnChange callback must be set")
-	}
-	if len(cfg.TargetFiles) == 0 {
-		return errors.New("at least one target file must be specified")
-	}
-
-	// Group files by directory to minimize the number of watchers
-	dirToFiles := make(map[string][]string)
-	for _, file := range cfg.TargetFiles {
-		dir := filepath.Dir(file)
-		dirToFiles[dir] = append(dirToFiles[dir], file)
-	}
-
-	if cfg.OnEvent != nil {
-		cfg.OnEvent(fmt.Sprintf("watching %d files across %d directories", len(cfg.TargetFiles), len(dirToFiles)))
-	}
-
-	for {
-		w, err := fsnotify.NewWatcher()
-		if err != nil {
-			if cfg.OnError != nil {
-				cfg.OnError(err)
-			}
-			select {
-			case <-time.After(cfg.RetryDelay):
-				continue
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-
-		// Add all directories to the watcher
-		for dir := range dirToFiles {
-			if err := w.Add(dir); err != nil {
-				if cfg.OnError != nil {
-					cfg.OnError(fmt.Errorf("failed to watch directory %s: %w", dir, err))
-				}
-				_ = w.Close()
-				select {
-				case <-time.After(cfg.RetryDelay):
-					continue
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
-			if cfg.OnEvent != nil {
-				cfg.OnEvent("watching directory: " + dir)
-			}
+	var actions *actionGraph
+	if len(cfg.Actions) > 0 {
+		var err error
+		if actions, err = newActionGraph(cfg.Actions); err != nil {
+			return nil, err
 		}
-
-		// Channel to receive debounced events
-		debouncedEvents := make(chan string, len(cfg.TargetFiles))
-
-		// Active timers for debouncing
-		activeTimers := make(map[string]*time.Timer)
-		timerMutex := sync.Mutex{}
-
-	loop:
-		for {
-			select {
-			case <-ctx.Done():
-				_ = w.Close()
-				// Stop all active timers
-				timerMutex.Lock()
-				for _, timer := range activeTimers {
-					timer.Stop()
-				}
-				timerMutex.Unlock()
-				return ctx.Err()
-
-			case ev := <-w.Events:
-				// Check if this event is for one of our target files
-				for _, targetFile := range cfg.TargetFiles {
-					if ev.Name == targetFile &&
-						(ev.Op&fsnotify.Write != 0 || ev.Op&fsnotify.Create != 0 ||
-							ev.Op&fsnotify.Rename != 0 || ev.Op&fsnotify.Remove != 0) {
-						if cfg.OnEvent != nil {
-							cfg.OnEvent("change detected: " + ev.String())
-						}
-
-						// Handle debouncing for this specific file
-						timerMutex.Lock()
-						if existingTimer, exists := activeTimers[targetFile]; exists {
-							existingTimer.Stop()
-						}
-
-						activeTimers[targetFile] = time.AfterFunc(cfg.Debounce, func() {
-							debouncedEvents <- targetFile
-							timerMutex.Lock()
-							delete(activeTimers, targetFile)
-							timerMutex.Unlock()
-						})
-						timerMutex.Unlock()
-						break
-					}
-				}
-
-			case file := <-debouncedEvents:
-				if cfg.OnEvent != nil {
-					cfg.OnEvent("sending signal for: " + file)
-				}
-				cfg.OnChange(file) // trigger reload with the specific file
-
-			case err := <-w.Errors:
-				if err != nil && cfg.OnError != nil {
-					cfg.OnError(err)
-				}
-				break loop // recreate watcher
+		for _, file := range actions.files() {
+			if !slices.Contains(cfg.TargetFiles, file) {
+				cfg.TargetFiles = append(slices.Clip(cfg.TargetFiles), file)
 			}
 		}
-		_ = w.Close()
 	}
+	if len(cfg.TargetFiles) == 0 {
+		return nil, errors.New("at least one target file must be specified")
+	}
+
+	e := newEngine(cfg.TargetFiles, cfg.Debounce, cfg.RetryDelay)
+	e.retry = cfg.Retry
+	e.setBackend(cfg.Backend, cfg.Clock)
+	e.onEvent = cfg.OnEvent
+	e.onError = cfg.OnError
+	e.signals = cfg.Signals
+	e.metrics = cfg.Metrics
+	e.journal = cfg.Journal
+	e.stateFile = cfg.StateFile
+	e.stateReportOnly = cfg.StateReportOnly
+	e.fireOnStart = cfg.FireOnStart
+	e.onMissing = cfg.OnMissing
+	e.coalesce = cfg.CoalesceSaves
+	e.removeGrace = cfg.RemoveGrace
+	e.opCallbacks = opCallbacks{cfg.OnCreate, cfg.OnModify, cfg.OnRemove, cfg.OnRename, cfg.OnChmod}
+	e.ops = cfg.Ops
+	e.targetOps = cfg.TargetOps
+	e.middleware = cfg.Middleware
+	e.callbackTimeout = cfg.CallbackTimeout
+	e.actions = actions
+	return e, nil
 }
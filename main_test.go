@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -191,14 +192,23 @@ func TestWatch_MultipleChanges_Debounced(t *testing.T) {
 }
 
 func TestWatch_NonExistentFile(t *testing.T) {
-	nonExistentFile := filepath.Join(os.TempDir(), "nonexistent", "file.txt")
+	// The target's directory does not exist yet: the watcher waits on the
+	// nearest existing ancestor and walks down as directories appear.
+	root := t.TempDir()
+	nonExistentFile := filepath.Join(root, "nonexistent", "nested", "file.txt")
 
 	var mu sync.Mutex
+	var changeCount int
 	var errorList []error
 
 	config := Config{
 		TargetFile: nonExistentFile,
-		OnChange:   func() {},
+		OnChange: func() {
+			mu.Lock()
+			changeCount++
+			mu.Unlock()
+		},
+		Debounce:   50 * time.Millisecond,
 		RetryDelay: 10 * time.Millisecond,
 		OnError: func(err error) {
 			mu.Lock()
@@ -207,20 +217,40 @@ func TestWatch_NonExistentFile(t *testing.T) {
 		},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := Watch(ctx, config)
-	if !errors.Is(err, context.DeadlineExceeded) {
-		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, config)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.MkdirAll(filepath.Dir(nonExistentFile), 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
 	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(nonExistentFile, []byte("finally here"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
 
 	mu.Lock()
+	gotChanges := changeCount
 	gotErrors := len(errorList)
 	mu.Unlock()
 
-	if gotErrors == 0 {
-		t.Error("Expected errors when watching non-existent directory")
+	if gotChanges == 0 {
+		t.Error("Expected a change callback once the file was created")
+	}
+	if gotErrors > 0 {
+		t.Errorf("Missing directories should not be reported as errors: %v", errorList)
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from Watch: %v", err)
 	}
 }
 
@@ -825,6 +855,7 @@ func TestWatchMultiple_SameDirectory(t *testing.T) {
 
 	var mu sync.Mutex
 	var changedFiles []string
+	var events []string
 
 	config := MultiConfig{
 		TargetFiles: []string{file1, file2},
@@ -833,6 +864,11 @@ func TestWatchMultiple_SameDirectory(t *testing.T) {
 			changedFiles = append(changedFiles, file)
 			mu.Unlock()
 		},
+		OnEvent: func(msg string) {
+			mu.Lock()
+			events = append(events, msg)
+			mu.Unlock()
+		},
 		Debounce:   50 * time.Millisecond,
 		RetryDelay: 10 * time.Millisecond,
 	}
@@ -860,8 +896,13 @@ func TestWatchMultiple_SameDirectory(t *testing.T) {
 	mu.Lock()
 	gotChangedFiles := make([]string, len(changedFiles))
 	copy(gotChangedFiles, changedFiles)
+	gotEvents := strings.Join(events, "\n")
 	mu.Unlock()
 
+	if n := strings.Count(gotEvents, "watching directory: "+tempDir); n != 1 {
+		t.Errorf("Expected the shared directory to be reported once, got %d times:\n%s", n, gotEvents)
+	}
+
 	if len(gotChangedFiles) < 2 {
 		t.Errorf("Expected at least 2 file changes, got %d", len(gotChangedFiles))
 	}
@@ -871,3 +912,67 @@ func TestWatchMultiple_SameDirectory(t *testing.T) {
 		t.Errorf("Unexpected error from WatchMultiple: %v", err)
 	}
 }
+
+func TestWatchMultiple_MissingDirectoryDoesNotBlockOthers(t *testing.T) {
+	existing := createTempFile(t)
+	missing := filepath.Join(t.TempDir(), "later", "file.txt")
+
+	var mu sync.Mutex
+	var changedFiles []string
+
+	config := MultiConfig{
+		TargetFiles: []string{missing, existing},
+		OnChange: func(file string) {
+			mu.Lock()
+			changedFiles = append(changedFiles, file)
+			mu.Unlock()
+		},
+		Debounce:   50 * time.Millisecond,
+		RetryDelay: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchMultiple(ctx, config)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(existing, []byte("modified"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	gotChangedFiles := append([]string(nil), changedFiles...)
+	mu.Unlock()
+
+	if len(gotChangedFiles) != 1 || gotChangedFiles[0] != existing {
+		t.Fatalf("Expected only %s to change, got %v", existing, gotChangedFiles)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(missing), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(missing, []byte("created"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	gotChangedFiles = append([]string(nil), changedFiles...)
+	mu.Unlock()
+
+	if len(gotChangedFiles) != 2 || gotChangedFiles[1] != missing {
+		t.Errorf("Expected %s to change once its directory appeared, got %v", missing, gotChangedFiles)
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from WatchMultiple: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package reloader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// metricOps are the operations reloader_events_total is broken down by.
+var metricOps = []fsnotify.Op{fsnotify.Create, fsnotify.Write, fsnotify.Remove, fsnotify.Rename, fsnotify.Chmod}
+
+// durationBuckets are the upper bounds, in seconds, of the callback
+// duration histogram (the Prometheus client defaults).
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects counters about watchers and reloads and serves them in
+// the Prometheus text exposition format. Set it as the Metrics field of a
+// config; one Metrics can be shared by several watchers, whose values are
+// then summed. A nil *Metrics discards everything.
+type Metrics struct {
+	mu             sync.Mutex
+	events         map[fsnotify.Op]uint64
+	debounceFires  uint64
+	callbacks      uint64
+	callbackErrors uint64
+	durationCounts []uint64 // per bucket, not cumulative
+	durationSum    float64
+	recreations    uint64
+	retries        uint64
+	watchedDirs    int
+}
+
+// NewMetrics returns an empty registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		events:         make(map[fsnotify.Op]uint64),
+		durationCounts: make([]uint64, len(durationBuckets)+1),
+	}
+}
+
+func (m *Metrics) event(op fsnotify.Op) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range metricOps {
+		if op.Has(o) {
+			m.events[o]++
+		}
+	}
+}
+
+func (m *Metrics) debounceFired() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.debounceFires++
+}
+
+func (m *Metrics) callback(d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callbacks++
+	if err != nil {
+		m.callbackErrors++
+	}
+	i := 0
+	for i < len(durationBuckets) && d.Seconds() > durationBuckets[i] {
+		i++
+	}
+	m.durationCounts[i]++
+	m.durationSum += d.Seconds()
+}
+
+func (m *Metrics) recreated() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recreations++
+}
+
+func (m *Metrics) retried() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries++
+}
+
+func (m *Metrics) addWatchedDirs(delta int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchedDirs += delta
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo writes all metrics to w in the Prometheus text format. A nil
+// *Metrics writes nothing.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	header := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("reloader_events_total", "counter", "Filesystem events seen, by operation.")
+	for _, op := range metricOps {
+		fmt.Fprintf(&b, "reloader_events_total{op=%q} %d\n", strings.ToLower(op.String()), m.events[op])
+	}
+	header("reloader_debounce_fires_total", "counter", "Debounce timers that expired and triggered a reload.")
+	fmt.Fprintf(&b, "reloader_debounce_fires_total %d\n", m.debounceFires)
+	header("reloader_callbacks_total", "counter", "Reload callback invocations.")
+	fmt.Fprintf(&b, "reloader_callbacks_total %d\n", m.callbacks)
+	header("reloader_callback_errors_total", "counter", "Reload callback invocations that returned an error.")
+	fmt.Fprintf(&b, "reloader_callback_errors_total %d\n", m.callbackErrors)
+
+	header("reloader_callback_duration_seconds", "histogram", "Duration of reload callbacks.")
+	var cumulative uint64
+	for i, le := range durationBuckets {
+		cumulative += m.durationCounts[i]
+		fmt.Fprintf(&b, "reloader_callback_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	cumulative += m.durationCounts[len(durationBuckets)]
+	fmt.Fprintf(&b, "reloader_callback_duration_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(&b, "reloader_callback_duration_seconds_sum %s\n", strconv.FormatFloat(m.durationSum, 'g', -1, 64))
+	fmt.Fprintf(&b, "reloader_callback_duration_seconds_count %d\n", cumulative)
+
+	header("reloader_watcher_recreations_total", "counter", "Times the event source was recreated after an error.")
+	fmt.Fprintf(&b, "reloader_watcher_recreations_total %d\n", m.recreations)
+	header("reloader_retry_attempts_total", "counter", "Retries scheduled after failing to create the event source or watch a directory.")
+	fmt.Fprintf(&b, "reloader_retry_attempts_total %d\n", m.retries)
+	header("reloader_watched_directories", "gauge", "Directories currently watched.")
+	fmt.Fprintf(&b, "reloader_watched_directories %d\n", m.watchedDirs)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
@@ -0,0 +1,87 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics_CountsReloads(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMetrics()
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{file},
+		Debounce:    30 * time.Millisecond,
+		Metrics:     m,
+		Handler: HandlerFunc(func(context.Context, ChangeEvent) error {
+			return errors.New("bad config")
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching == dir })
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return w.Status().Targets[0].Reloads == 1 })
+
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# TYPE reloader_events_total counter",
+		"reloader_debounce_fires_total 1\n",
+		"reloader_callbacks_total 1\n",
+		"reloader_callback_errors_total 1\n",
+		"reloader_callback_duration_seconds_count 1\n",
+		"reloader_callback_duration_seconds_bucket{le=\"+Inf\"} 1\n",
+		"reloader_watched_directories 1\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "reloader_events_total{op=\"write\"} 0\n") {
+		t.Errorf("write event not counted:\n%s", body)
+	}
+}
+
+func TestMetrics_NilIsDiscarded(t *testing.T) {
+	var m *Metrics
+	m.event(0)
+	m.callback(time.Second, nil)
+	m.addWatchedDirs(1)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("got %d %q, want an empty exposition", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,208 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHandlerAttempts is the number of calls Retry makes when its policy
+// sets neither MaxAttempts nor MaxElapsed.
+const DefaultHandlerAttempts = 3
+
+// ErrHandlerTimeout is returned by a handler wrapped with Timeout, or a
+// callback running longer than CallbackTimeout, that did not return in time.
+var ErrHandlerTimeout = errors.New("handler timed out")
+
+// PanicError is the error a recovered panic of a handler turns into. Its
+// message is a single line, since it ends up in Status and the journal; the
+// stack is only available from the Stack field.
+type PanicError struct {
+	Path  string // the path of the change being handled
+	Value any    // the value passed to panic
+	Stack []byte // the stack of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic handling %s: %v", e.Path, e.Value)
+}
+
+// protect calls h, turning a panic into a *PanicError.
+func protect(ctx context.Context, h Handler, ev ChangeEvent) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Path: ev.Path, Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return h.HandleChange(ctx, ev)
+}
+
+// callWithTimeout calls h with a context cancelled after d. If h has not
+// returned by then, it returns an error wrapping ErrHandlerTimeout and
+// leaves h running in the background. Panics are returned as *PanicError.
+func callWithTimeout(ctx context.Context, h Handler, ev ChangeEvent, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- protect(ctx, h, ev)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w after %s", ErrHandlerTimeout, d)
+	}
+}
+
+// Middleware wraps a Handler with extra behavior.
+type Middleware func(Handler) Handler
+
+// envKey is the context key of the handlerEnv a watcher runs handlers with.
+type envKey struct{}
+
+// handlerEnv is what middleware takes from the watcher calling it, so that
+// it reads files through the same Backend and waits on the same Clock.
+type handlerEnv struct {
+	backend Backend
+	clock   Clock
+}
+
+// withEnv returns ctx carrying backend and clock for middleware.
+func withEnv(ctx context.Context, backend Backend, clock Clock) context.Context {
+	return context.WithValue(ctx, envKey{}, handlerEnv{backend, clock})
+}
+
+// envFrom returns the handlerEnv of ctx, or OSBackend and RealClock for a
+// handler called outside a watcher.
+func envFrom(ctx context.Context) handlerEnv {
+	if env, ok := ctx.Value(envKey{}).(handlerEnv); ok {
+		return env
+	}
+	return handlerEnv{OSBackend{}, RealClock{}}
+}
+
+// Use wraps h with mw. The first middleware is the outermost one, so it
+// sees every call first and every result last.
+func Use(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Recover turns a panic in the handler into a *PanicError. Watchers already
+// do this for their callbacks; Recover is for inner middleware such as
+// Retry that should see the panic as a failure.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, ev ChangeEvent) error {
+			return protect(ctx, next, ev)
+		})
+	}
+}
+
+// Timeout cancels the handler's context after d and returns an error
+// wrapping ErrHandlerTimeout without waiting any longer. A handler that
+// ignores its context keeps running in the background until it returns.
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, ev ChangeEvent) error {
+			return callWithTimeout(ctx, next, ev, d)
+		})
+	}
+}
+
+// Retry calls the handler again while it fails, waiting delay before the
+// first retry and growing the wait as policy says. Without MaxAttempts or
+// MaxElapsed in policy it gives up after DefaultHandlerAttempts calls and
+// returns an error wrapping ErrRetriesExhausted and the last failure. The
+// waits use the Clock of the watcher calling it.
+func Retry(delay time.Duration, policy RetryPolicy) Middleware {
+	if policy.MaxAttempts == 0 && policy.MaxElapsed == 0 {
+		policy.MaxAttempts = DefaultHandlerAttempts
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, ev ChangeEvent) error {
+			clock := envFrom(ctx).clock
+			b := newBackoff(delay, policy, clock)
+			for {
+				err := next.HandleChange(ctx, ev)
+				if err == nil || ctx.Err() != nil {
+					return err
+				}
+				wait, exhausted := b.next(err)
+				if exhausted != nil {
+					return exhausted
+				}
+				if err := sleep(ctx, clock, wait); err != nil {
+					return err
+				}
+			}
+		})
+	}
+}
+
+// Dedupe skips file changes that leave a file with the same content as the
+// last change the handler handled successfully, such as a touch or a save
+// without edits. Signal-triggered and manual reloads always pass. Files
+// are read through the Backend of the watcher calling it.
+func Dedupe() Middleware {
+	return func(next Handler) Handler {
+		var mu sync.Mutex
+		handled := make(map[string]string) // path -> digest
+		return HandlerFunc(func(ctx context.Context, ev ChangeEvent) error {
+			sum, err := digestFile(envFrom(ctx).backend, ev.Path)
+			if err != nil {
+				return next.HandleChange(ctx, ev)
+			}
+			mu.Lock()
+			last, ok := handled[ev.Path]
+			mu.Unlock()
+			if ok && last == sum && strings.HasPrefix(ev.Source, "file:") {
+				return nil
+			}
+
+			if err := next.HandleChange(ctx, ev); err != nil {
+				return err
+			}
+			mu.Lock()
+			handled[ev.Path] = sum
+			mu.Unlock()
+			return nil
+		})
+	}
+}
+
+// RateLimit makes calls start at least every apart, waiting as needed.
+// The wait blocks the watcher like a slow handler does: filesystem events
+// queue up in the kernel and are handled once the call returns, and a
+// queue overflow meanwhile is caught up on by a rescan.
+func RateLimit(every time.Duration) Middleware {
+	return func(next Handler) Handler {
+		var mu sync.Mutex
+		var last time.Time
+		return HandlerFunc(func(ctx context.Context, ev ChangeEvent) error {
+			clock := envFrom(ctx).clock
+			mu.Lock()
+			now := clock.Now()
+			wait := last.Add(every).Sub(now)
+			last = now.Add(max(wait, 0))
+			mu.Unlock()
+			if wait > 0 {
+				if err := sleep(ctx, clock, wait); err != nil {
+					return err
+				}
+			}
+			return next.HandleChange(ctx, ev)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_Order(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, ev ChangeEvent) error {
+				calls = append(calls, name)
+				return next.HandleChange(ctx, ev)
+			})
+		}
+	}
+	h := Use(HandlerFunc(func(context.Context, ChangeEvent) error {
+		calls = append(calls, "handler")
+		return nil
+	}), tag("outer"), tag("inner"))
+
+	if err := h.HandleChange(context.Background(), ChangeEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, ","); got != "outer,inner,handler" {
+		t.Errorf("calls = %s", got)
+	}
+}
+
+func TestMiddleware_RecoverTimeoutRetry(t *testing.T) {
+	ctx := context.Background()
+
+	panicking := Use(HandlerFunc(func(context.Context, ChangeEvent) error { panic("boom") }), Recover())
+	if err := panicking.HandleChange(ctx, ChangeEvent{Path: "/a"}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Recover: got %v", err)
+	}
+
+	hung := Use(HandlerFunc(func(ctx context.Context, _ ChangeEvent) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), Timeout(20*time.Millisecond))
+	if err := hung.HandleChange(ctx, ChangeEvent{}); !errors.Is(err, ErrHandlerTimeout) {
+		t.Errorf("Timeout: got %v", err)
+	}
+
+	attempts := 0
+	flaky := Use(HandlerFunc(func(context.Context, ChangeEvent) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}), Retry(time.Millisecond, RetryPolicy{}))
+	if err := flaky.HandleChange(ctx, ChangeEvent{}); err != nil || attempts != 3 {
+		t.Errorf("Retry: err %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	failing := Use(HandlerFunc(func(context.Context, ChangeEvent) error {
+		attempts++
+		return errors.New("always")
+	}), Retry(time.Millisecond, RetryPolicy{}))
+	if err := failing.HandleChange(ctx, ChangeEvent{}); !errors.Is(err, ErrRetriesExhausted) || attempts != DefaultHandlerAttempts {
+		t.Errorf("Retry: err %v after %d attempts", err, attempts)
+	}
+}
+
+func TestMiddleware_DedupeAndRateLimit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ev := ChangeEvent{Path: file, Source: "file:" + file}
+
+	calls := 0
+	h := Use(HandlerFunc(func(context.Context, ChangeEvent) error {
+		calls++
+		return nil
+	}), Dedupe(), RateLimit(50*time.Millisecond))
+
+	start := time.Now()
+	for range 2 {
+		if err := h.HandleChange(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("unchanged content handled %d times", calls)
+	}
+	manual := ev
+	manual.Source = "manual"
+	if err := h.HandleChange(ctx, manual); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.HandleChange(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected the manual reload and the new content to be handled, got %d calls", calls)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("three calls took %s, RateLimit not applied", d)
+	}
+}
+
+func TestWatch_Middleware(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = Watch(ctx, Config{
+			TargetFile: file,
+			Debounce:   30 * time.Millisecond,
+			Handler: HandlerFunc(func(context.Context, ChangeEvent) error {
+				panic("bad config")
+			}),
+			Middleware: []Middleware{Recover()},
+			OnError:    func(err error) { errs <- err },
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "bad config") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic was not turned into an error")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package reloader
+
+// monotonicUsec is not needed outside Linux, where systemd does not run.
+func monotonicUsec() (int64, bool) {
+	return 0, false
+}
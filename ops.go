@@ -0,0 +1,66 @@
+package reloader
+
+import (
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultOps are the operations that trigger a change unless Ops says
+// otherwise. Chmod is left out because many tools touch permissions or
+// timestamps without changing content; add it to Ops to be told about
+// permission changes.
+const DefaultOps = fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename
+
+// opCallbacks are the optional per-operation callbacks of a config.
+type opCallbacks struct {
+	onCreate func(string)
+	onModify func(string)
+	onRemove func(string)
+	onRename func(string)
+	onChmod  func(string)
+}
+
+// set reports whether any callback is set.
+func (c opCallbacks) set() bool {
+	return c.onCreate != nil || c.onModify != nil || c.onRemove != nil || c.onRename != nil || c.onChmod != nil
+}
+
+// dispatch calls the callback of every operation in ev.Op that agrees with
+// whether the file exists at delivery, in the order create, modify, rename,
+// remove, chmod. A file removed and written again within the debounce
+// window exists, so it is reported as created and modified, not removed;
+// one written and then removed is only reported as removed.
+func (c opCallbacks) dispatch(ev ChangeEvent, exists bool) {
+	for _, cb := range []struct {
+		op      fsnotify.Op
+		present bool
+		fn      func(string)
+	}{
+		{fsnotify.Create, true, c.onCreate},
+		{fsnotify.Write, true, c.onModify},
+		{fsnotify.Rename, false, c.onRename},
+		{fsnotify.Remove, false, c.onRemove},
+		{fsnotify.Chmod, true, c.onChmod},
+	} {
+		if cb.fn != nil && ev.Op.Has(cb.op) && cb.present == exists {
+			cb.fn(ev.Path)
+		}
+	}
+}
+
+// dispatch hands ev to the per-operation callbacks, if any.
+func (e *engine) dispatch(ev ChangeEvent) {
+	if e.opCallbacks.set() {
+		e.opCallbacks.dispatch(ev, e.stat(ev.Path).exists)
+	}
+}
+
+// mask returns the operations that trigger a change of path.
+func (e *engine) mask(path string) fsnotify.Op {
+	if ops := e.targetOps[path]; ops != 0 {
+		return ops
+	}
+	if e.ops != 0 {
+		return e.ops
+	}
+	return DefaultOps
+}
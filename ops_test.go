@@ -0,0 +1,178 @@
+package reloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestOps_PerOperationCallbacks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(chan string, 10)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{file},
+		Debounce:    30 * time.Millisecond,
+		Ops:         DefaultOps | fsnotify.Chmod,
+		OnModify:    func(string) { calls <- "modify" },
+		OnRemove:    func(string) { calls <- "remove" },
+		OnChmod:     func(string) { calls <- "chmod" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching == dir })
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s callback", want)
+		}
+	}
+
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expect("modify")
+	if err := os.Chmod(file, 0o400); err != nil {
+		t.Fatal(err)
+	}
+	expect("chmod")
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	expect("remove")
+}
+
+func TestOps_TargetMask(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, f := range []string{a, b} {
+		if err := os.WriteFile(f, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := make(chan ChangeEvent, 10)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{a, b},
+		Debounce:    30 * time.Millisecond,
+		TargetOps:   map[string]fsnotify.Op{a: fsnotify.Remove},
+		Handler: HandlerFunc(func(_ context.Context, ev ChangeEvent) error {
+			changes <- ev
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching == dir })
+
+	for _, f := range []string{a, b} {
+		if err := os.WriteFile(f, []byte("y"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case ev := <-changes:
+		if ev.Path != b {
+			t.Fatalf("write to %s passed its Remove-only mask", ev.Path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write to b not delivered")
+	}
+
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-changes:
+		if ev.Path != a || ev.Op != fsnotify.Remove {
+			t.Errorf("got %+v, want the removal of a", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("removal of a not delivered")
+	}
+}
+
+func TestOps_CallbacksFollowTheFileAtDelivery(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(chan string, 10)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{file},
+		Debounce:    100 * time.Millisecond,
+		OnCreate:    func(string) { calls <- "create" },
+		OnModify:    func(string) { calls <- "modify" },
+		OnRemove:    func(string) { calls <- "remove" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching == dir })
+
+	collect := func() []string {
+		t.Helper()
+		var got []string
+		for {
+			select {
+			case call := <-calls:
+				got = append(got, call)
+			case <-time.After(300 * time.Millisecond):
+				return got
+			}
+		}
+	}
+
+	// Removed and written again within the debounce window: it exists.
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(); !slices.Equal(got, []string{"create", "modify"}) {
+		t.Errorf("remove then recreate: got %v, want [create modify]", got)
+	}
+
+	// Written and then removed: it is gone.
+	if err := os.WriteFile(file, []byte("c"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(); !slices.Equal(got, []string{"remove"}) {
+		t.Errorf("write then remove: got %v, want [remove]", got)
+	}
+}
@@ -0,0 +1,208 @@
+// Package reloadertest provides fakes for testing code built on reloader
+// without real files or sleeps: a Clock that only moves when told to, an
+// in-memory FS that emits synthetic filesystem events, and a Recorder with
+// assertion helpers such as ExpectReload.
+//
+//	clock := reloadertest.NewClock()
+//	fsys := reloadertest.NewFS(clock)
+//	fsys.WriteFile("/etc/app/config.yaml", []byte("v1"))
+//	rec := reloadertest.NewRecorder(clock)
+//
+//	go reloader.Watch(ctx, reloader.Config{
+//	    TargetFile: "/etc/app/config.yaml",
+//	    OnChange:   rec.OnChange,
+//	    Backend:    fsys,
+//	    Clock:      clock,
+//	})
+//	fsys.WaitWatched(t, "/etc/app")
+//
+//	fsys.WriteFile("/etc/app/config.yaml", []byte("v2"))
+//	rec.ExpectReload(t, reloader.DefaultDebounce)
+package reloadertest
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blackorder/reloader"
+)
+
+// Clock is a fake reloader.Clock. Time stands still until Advance is
+// called, which fires every timer that became due.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+	added  chan struct{} // signalled whenever a timer is scheduled
+}
+
+type timer struct {
+	clock *Clock
+	when  time.Time
+	f     func()         // set for AfterFunc timers
+	c     chan time.Time // set for NewTimer timers
+}
+
+// NewClock returns a fake clock set to an arbitrary fixed time.
+func NewClock() *Clock {
+	return &Clock{
+		now:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		added: make(chan struct{}, 1),
+	}
+}
+
+// Now returns the fake current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer whose channel receives the fake time once the
+// clock has been advanced by d.
+func (c *Clock) NewTimer(d time.Duration) reloader.Timer {
+	t := &timer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc schedules f to run in its own goroutine once the clock has
+// been advanced by d.
+func (c *Clock) AfterFunc(d time.Duration, f func()) reloader.Timer {
+	t := &timer{clock: c, f: f}
+	t.Reset(d)
+	return t
+}
+
+// WaitTimers blocks until at least n timers are pending, failing t if that
+// does not happen within a second of real time. Use it to wait for the
+// code under test to start waiting before calling Advance.
+func (c *Clock) WaitTimers(t testing.TB, n int) {
+	t.Helper()
+
+	deadline := time.After(realTimeout)
+	for c.Pending() < n {
+		select {
+		case <-c.added:
+		case <-deadline:
+			t.Fatalf("expected %d pending timers, got %d", n, c.Pending())
+		}
+	}
+}
+
+// Advance moves the clock forward by d, firing due timers in deadline order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+	c.AdvanceTo(target)
+}
+
+// AdvanceTo moves the clock forward to t, firing due timers in deadline
+// order. It never moves the clock backwards.
+func (c *Clock) AdvanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+	for len(c.timers) > 0 && !c.timers[0].when.After(t) {
+		next := c.timers[0]
+		c.timers = c.timers[1:]
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		next.fire()
+	}
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// Next returns the deadline of the earliest pending timer.
+func (c *Clock) Next() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.timers) == 0 {
+		return time.Time{}, false
+	}
+	next := c.timers[0].when
+	for _, t := range c.timers[1:] {
+		if t.when.Before(next) {
+			next = t.when
+		}
+	}
+	return next, true
+}
+
+// Pending returns the number of timers that have not fired or been stopped.
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// C implements reloader.Timer.
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop cancels the timer, reporting whether it was still pending.
+func (t *timer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.remove()
+}
+
+// Reset reschedules the timer to fire d after the current fake time,
+// reporting whether it was still pending.
+func (t *timer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	active := t.remove()
+	t.when = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+
+	if d <= 0 {
+		c.Advance(0)
+	}
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+	return active
+}
+
+// remove unschedules the timer and drops an undelivered tick, matching
+// time.Timer since Go 1.23. clock.mu must be held.
+func (t *timer) remove() bool {
+	if t.c != nil {
+		select {
+		case <-t.c:
+		default:
+		}
+	}
+	c := t.clock
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fire runs or delivers the timer. clock.mu must be held.
+func (t *timer) fire() {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	select {
+	case t.c <- t.when:
+	default:
+	}
+}
@@ -0,0 +1,362 @@
+package reloadertest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blackorder/reloader"
+	"github.com/fsnotify/fsnotify"
+)
+
+// eventBuffer is the queue length of each event source. Events beyond it
+// are dropped and reported as fsnotify.ErrEventOverflow, like inotify does.
+const eventBuffer = 64
+
+// FS is an in-memory reloader.Backend. Its mutating methods update the
+// tree and emit the events fsnotify would deliver for the same operation to
+// every event source watching the affected directory.
+type FS struct {
+	clock *Clock
+
+	mu        sync.Mutex
+	nodes     map[string]*node
+	sources   map[*source]bool
+	sourceErr error
+}
+
+type node struct {
+	dir     bool
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewFS returns an empty filesystem containing only the root directory.
+// Modification times come from clock, or the real time if clock is nil.
+func NewFS(clock *Clock) *FS {
+	f := &FS{
+		clock:   clock,
+		nodes:   make(map[string]*node),
+		sources: make(map[*source]bool),
+	}
+	f.nodes[filepath.VolumeName("")+string(filepath.Separator)] = &node{dir: true, mode: fs.ModeDir | 0o755}
+	return f
+}
+
+// NewEventSource implements reloader.Backend.
+func (f *FS) NewEventSource() (reloader.EventSource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sourceErr != nil {
+		return nil, f.sourceErr
+	}
+	s := &source{
+		fs:      f,
+		events:  make(chan fsnotify.Event, eventBuffer),
+		errors:  make(chan error, eventBuffer),
+		watches: make(map[string]bool),
+	}
+	f.sources[s] = true
+	return s, nil
+}
+
+// Stat implements reloader.Backend.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name = filepath.Clean(name)
+	n, ok := f.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fileInfo{name: filepath.Base(name), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}, nil
+}
+
+// Open implements reloader.Backend.
+func (f *FS) Open(name string) (io.ReadCloser, error) {
+	data, err := f.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ReadFile returns the content of the file name.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, ok := f.nodes[filepath.Clean(name)]
+	if !ok || n.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+// MkdirAll creates dir and any missing parents, emitting a Create event for
+// each directory it creates.
+func (f *FS) MkdirAll(dir string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mkdirAll(filepath.Clean(dir))
+}
+
+// WriteFile replaces the content of name, creating it (and its parent
+// directories) if needed. It emits Create for a new file followed by Write.
+func (f *FS) WriteFile(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name = filepath.Clean(name)
+	f.mkdirAll(filepath.Dir(name))
+	n, ok := f.nodes[name]
+	if !ok {
+		n = &node{mode: 0o644}
+		f.nodes[name] = n
+		f.emit(name, fsnotify.Create)
+	}
+	n.data = append([]byte(nil), data...)
+	n.modTime = f.now()
+	f.emit(name, fsnotify.Write)
+}
+
+// Chmod changes the mode of name and emits a Chmod event.
+func (f *FS) Chmod(name string, mode fs.FileMode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if n, ok := f.nodes[name]; ok {
+		n.mode = n.mode&fs.ModeType | mode.Perm()
+		f.emit(name, fsnotify.Chmod)
+	}
+}
+
+// Remove deletes name and everything below it, emitting Remove. Watches on
+// removed directories are dropped, as the kernel does.
+func (f *FS) Remove(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := f.nodes[name]; !ok {
+		return
+	}
+	for path := range f.subtree(name) {
+		delete(f.nodes, path)
+	}
+	f.emit(name, fsnotify.Remove)
+	f.dropWatches(name, fsnotify.Remove)
+}
+
+// Rename moves oldname (and everything below it) to newname, replacing any
+// existing file there. It emits Rename for oldname and Create for newname,
+// which is how an editor's atomic save looks to fsnotify.
+func (f *FS) Rename(oldname, newname string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	if _, ok := f.nodes[oldname]; !ok {
+		return
+	}
+	f.mkdirAll(filepath.Dir(newname))
+	for path, n := range f.subtree(oldname) {
+		delete(f.nodes, path)
+		f.nodes[newname+strings.TrimPrefix(path, oldname)] = n
+	}
+	f.emit(oldname, fsnotify.Rename)
+	f.dropWatches(oldname, fsnotify.Rename)
+	f.emit(newname, fsnotify.Create)
+}
+
+// Overflow reports fsnotify.ErrEventOverflow on every event source, as if
+// the kernel queue had overflowed.
+func (f *FS) Overflow() {
+	f.Fail(fsnotify.ErrEventOverflow)
+}
+
+// Fail reports err on every event source's error channel.
+func (f *FS) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for s := range f.sources {
+		select {
+		case s.errors <- err:
+		default:
+		}
+	}
+}
+
+// FailNewEventSource makes NewEventSource return err until it is called
+// again with nil.
+func (f *FS) FailNewEventSource(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sourceErr = err
+}
+
+// Watched reports whether any open event source is watching dir.
+func (f *FS) Watched(dir string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	for s := range f.sources {
+		if s.watches[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitWatched blocks until dir is watched, failing t if that does not
+// happen within a second of real time.
+func (f *FS) WaitWatched(t testing.TB, dir string) {
+	t.Helper()
+
+	deadline := time.Now().Add(realTimeout)
+	for !f.Watched(dir) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not watched within %s", dir, realTimeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *FS) now() time.Time {
+	if f.clock != nil {
+		return f.clock.Now()
+	}
+	return time.Now()
+}
+
+// mkdirAll creates dir and its parents. f.mu must be held.
+func (f *FS) mkdirAll(dir string) {
+	if n, ok := f.nodes[dir]; ok && n.dir {
+		return
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		f.mkdirAll(parent)
+	}
+	f.nodes[dir] = &node{dir: true, mode: fs.ModeDir | 0o755, modTime: f.now()}
+	f.emit(dir, fsnotify.Create)
+}
+
+// subtree returns name and every node below it. f.mu must be held.
+func (f *FS) subtree(name string) map[string]*node {
+	prefix := name + string(filepath.Separator)
+	nodes := make(map[string]*node)
+	for path, n := range f.nodes {
+		if path == name || strings.HasPrefix(path, prefix) {
+			nodes[path] = n
+		}
+	}
+	return nodes
+}
+
+// emit delivers an event for name to every source watching its directory.
+// f.mu must be held.
+func (f *FS) emit(name string, op fsnotify.Op) {
+	dir := filepath.Dir(name)
+	for s := range f.sources {
+		if s.watches[dir] {
+			s.send(fsnotify.Event{Name: name, Op: op})
+		}
+	}
+}
+
+// dropWatches removes watches on name and below, telling each source that
+// watched name itself. f.mu must be held.
+func (f *FS) dropWatches(name string, op fsnotify.Op) {
+	prefix := name + string(filepath.Separator)
+	for s := range f.sources {
+		if s.watches[name] {
+			s.send(fsnotify.Event{Name: name, Op: op})
+		}
+		for dir := range s.watches {
+			if dir == name || strings.HasPrefix(dir, prefix) {
+				delete(s.watches, dir)
+			}
+		}
+	}
+}
+
+// source is an event source created by FS.
+type source struct {
+	fs      *FS
+	events  chan fsnotify.Event
+	errors  chan error
+	watches map[string]bool // guarded by fs.mu
+}
+
+func (s *source) Add(name string) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := s.fs.nodes[name]; !ok {
+		return &fs.PathError{Op: "watch", Path: name, Err: fs.ErrNotExist}
+	}
+	s.watches[name] = true
+	return nil
+}
+
+func (s *source) Remove(name string) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if !s.watches[name] {
+		return errors.New("can't remove non-existent watch: " + name)
+	}
+	delete(s.watches, name)
+	return nil
+}
+
+func (s *source) Events() <-chan fsnotify.Event { return s.events }
+func (s *source) Errors() <-chan error          { return s.errors }
+
+func (s *source) Close() error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+	delete(s.fs.sources, s)
+	return nil
+}
+
+// send queues ev, reporting an overflow if the queue is full.
+func (s *source) send(ev fsnotify.Event) {
+	select {
+	case s.events <- ev:
+	default:
+		select {
+		case s.errors <- fsnotify.ErrEventOverflow:
+		default:
+		}
+	}
+}
+
+// fileInfo implements fs.FileInfo for FS nodes.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fileInfo) Sys() any           { return nil }
@@ -0,0 +1,114 @@
+package reloadertest
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// realTimeout bounds how long helpers wait, in real time, for the
+	// watcher goroutine to react.
+	realTimeout = time.Second
+	// settleTime is how long ExpectNoReload waits, in real time, for a
+	// reload that should not happen.
+	settleTime = 20 * time.Millisecond
+)
+
+// Recorder records reload callbacks and drives a Clock to assert on them.
+type Recorder struct {
+	clock   *Clock
+	reloads chan string
+
+	mu    sync.Mutex
+	paths []string
+}
+
+// NewRecorder returns a Recorder that advances clock in its assertions.
+func NewRecorder(clock *Clock) *Recorder {
+	return &Recorder{clock: clock, reloads: make(chan string, eventBuffer)}
+}
+
+// OnChange can be used as reloader.Config.OnChange.
+func (r *Recorder) OnChange() {
+	r.OnChangeFile("")
+}
+
+// OnChangeFile can be used as reloader.MultiConfig.OnChange.
+func (r *Recorder) OnChangeFile(path string) {
+	r.mu.Lock()
+	r.paths = append(r.paths, path)
+	r.mu.Unlock()
+	r.reloads <- path
+}
+
+// Count returns the number of reloads recorded so far.
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.paths)
+}
+
+// Paths returns the path of every reload recorded so far, in order. Reloads
+// recorded through OnChange have an empty path.
+func (r *Recorder) Paths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.paths...)
+}
+
+// ExpectReload advances the clock, at most by within, until a reload is
+// recorded and returns its path. It fails t if none happens.
+func (r *Recorder) ExpectReload(t testing.TB, within time.Duration) string {
+	t.Helper()
+
+	deadline := r.clock.Now().Add(within)
+	for {
+		select {
+		case path := <-r.reloads:
+			return path
+		default:
+		}
+
+		if next, ok := r.clock.Next(); ok && !next.After(deadline) {
+			r.clock.AdvanceTo(next)
+			continue
+		}
+
+		// Nothing is due yet: give the watcher goroutine a chance to
+		// schedule a timer or deliver the reload.
+		select {
+		case path := <-r.reloads:
+			return path
+		case <-r.clock.added:
+		case <-time.After(realTimeout):
+			r.clock.AdvanceTo(deadline)
+			t.Fatalf("expected a reload within %s", within)
+			return ""
+		}
+	}
+}
+
+// ExpectNoReload advances the clock by within and fails t if a reload is
+// recorded meanwhile.
+func (r *Recorder) ExpectNoReload(t testing.TB, within time.Duration) {
+	t.Helper()
+
+	deadline := r.clock.Now().Add(within)
+	for {
+		select {
+		case path := <-r.reloads:
+			t.Fatalf("unexpected reload of %q", path)
+		case <-time.After(settleTime):
+		}
+
+		if !r.clock.Now().Before(deadline) {
+			return
+		}
+		if next, ok := r.clock.Next(); ok && next.Before(deadline) {
+			r.clock.AdvanceTo(next)
+		} else {
+			r.clock.AdvanceTo(deadline)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package reloadertest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blackorder/reloader"
+	"github.com/blackorder/reloader/reloadertest"
+)
+
+func TestClock_AdvanceFiresDueTimers(t *testing.T) {
+	clock := reloadertest.NewClock()
+	start := clock.Now()
+
+	fired := make(chan time.Duration, 3)
+	clock.AfterFunc(2*time.Second, func() { fired <- 2 * time.Second })
+	clock.AfterFunc(time.Second, func() { fired <- time.Second })
+	stopped := clock.AfterFunc(1500*time.Millisecond, func() { fired <- 0 })
+
+	if !stopped.Stop() {
+		t.Error("Expected Stop to report a pending timer")
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	if got := <-fired; got != time.Second {
+		t.Errorf("Expected the 1s timer to fire, got %v", got)
+	}
+	if clock.Pending() != 1 {
+		t.Errorf("Expected 1 pending timer, got %d", clock.Pending())
+	}
+
+	clock.Advance(time.Second)
+	if got := <-fired; got != 2*time.Second {
+		t.Errorf("Expected the 2s timer to fire, got %v", got)
+	}
+	if got := clock.Now().Sub(start); got != 2500*time.Millisecond {
+		t.Errorf("Expected clock to be at +2.5s, got %v", got)
+	}
+}
+
+func TestWatch_DefaultDebounceWithoutSleeping(t *testing.T) {
+	clock := reloadertest.NewClock()
+	fsys := reloadertest.NewFS(clock)
+	fsys.WriteFile("/etc/app/config.yaml", []byte("v1"))
+	rec := reloadertest.NewRecorder(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- reloader.Watch(ctx, reloader.Config{
+			TargetFile: "/etc/app/config.yaml",
+			OnChange:   rec.OnChange,
+			Backend:    fsys,
+			Clock:      clock,
+		})
+	}()
+	fsys.WaitWatched(t, "/etc/app")
+
+	// Three writes one second apart keep resetting the 3s debounce.
+	for i := 0; i < 3; i++ {
+		fsys.WriteFile("/etc/app/config.yaml", []byte{byte('a' + i)})
+		rec.ExpectNoReload(t, time.Second)
+	}
+	rec.ExpectNoReload(t, reloader.DefaultDebounce-time.Second-time.Millisecond)
+	rec.ExpectReload(t, time.Millisecond)
+
+	if rec.Count() != 1 {
+		t.Errorf("Expected exactly 1 reload, got %d", rec.Count())
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWatchMultiple_MissingDirectoryAppears(t *testing.T) {
+	clock := reloadertest.NewClock()
+	fsys := reloadertest.NewFS(clock)
+	fsys.MkdirAll("/srv")
+	rec := reloadertest.NewRecorder(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	target := "/srv/app/releases/current/app"
+	go func() {
+		_ = reloader.WatchMultiple(ctx, reloader.MultiConfig{
+			TargetFiles: []string{target},
+			OnChange:    rec.OnChangeFile,
+			Debounce:    time.Second,
+			Backend:     fsys,
+			Clock:       clock,
+		})
+	}()
+	fsys.WaitWatched(t, "/srv")
+
+	fsys.WriteFile(target, []byte("binary"))
+
+	if got := rec.ExpectReload(t, time.Second); got != target {
+		t.Errorf("Expected reload of %s, got %s", target, got)
+	}
+	if !fsys.Watched("/srv/app/releases/current") {
+		t.Error("Expected the watch to walk down to the target's directory")
+	}
+}
+
+func TestWatch_BackoffInFakeTime(t *testing.T) {
+	clock := reloadertest.NewClock()
+	fsys := reloadertest.NewFS(clock)
+	fsys.FailNewEventSource(errors.New("too many open files"))
+	start := clock.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- reloader.Watch(ctx, reloader.Config{
+			TargetFile: "/etc/app/config.yaml",
+			OnChange:   func() {},
+			RetryDelay: time.Second,
+			Retry:      reloader.RetryPolicy{MaxAttempts: 5},
+			Backend:    fsys,
+			Clock:      clock,
+		})
+	}()
+
+	// Waits of 1s, 2s, 4s and 8s before the fifth failure gives up.
+	for i := 0; i < 4; i++ {
+		clock.WaitTimers(t, 1)
+		next, _ := clock.Next()
+		clock.AdvanceTo(next)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, reloader.ErrRetriesExhausted) {
+			t.Errorf("Expected ErrRetriesExhausted, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not give up")
+	}
+	if got := clock.Now().Sub(start); got != 15*time.Second {
+		t.Errorf("Expected 15s of fake backoff, got %v", got)
+	}
+}
+
+func TestWatchMultiple_MiddlewareUsesFakeBackendAndClock(t *testing.T) {
+	clock := reloadertest.NewClock()
+	fsys := reloadertest.NewFS(clock)
+	fsys.WriteFile("/etc/app/config.yaml", []byte("v1"))
+	rec := reloadertest.NewRecorder(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	go reloader.WatchMultiple(ctx, reloader.MultiConfig{
+		TargetFiles: []string{"/etc/app/config.yaml"},
+		Backend:     fsys,
+		Clock:       clock,
+		Middleware:  []reloader.Middleware{reloader.Dedupe(), reloader.Retry(time.Minute, reloader.RetryPolicy{})},
+		Handler: reloader.HandlerFunc(func(_ context.Context, ev reloader.ChangeEvent) error {
+			calls++
+			if calls == 1 {
+				return errors.New("not ready")
+			}
+			rec.OnChangeFile(ev.Path)
+			return nil
+		}),
+	})
+	fsys.WaitWatched(t, "/etc/app")
+
+	// The retry waits a fake minute.
+	fsys.WriteFile("/etc/app/config.yaml", []byte("v2"))
+	rec.ExpectReload(t, reloader.DefaultDebounce+time.Minute)
+
+	// Dedupe digests the fake file, so new content passes and the same
+	// content does not.
+	fsys.WriteFile("/etc/app/config.yaml", []byte("v3"))
+	rec.ExpectReload(t, reloader.DefaultDebounce)
+	fsys.WriteFile("/etc/app/config.yaml", []byte("v3"))
+	rec.ExpectNoReload(t, 2*reloader.DefaultDebounce)
+}
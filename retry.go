@@ -0,0 +1,79 @@
+package reloader
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// DefaultRetryMultiplier is the default growth factor between retry delays.
+	DefaultRetryMultiplier = 2
+	// DefaultMaxRetryDelay is the default upper bound for a single retry delay.
+	DefaultMaxRetryDelay = time.Minute
+)
+
+// ErrRetriesExhausted is returned (wrapped together with the last underlying
+// error) when a RetryPolicy gives up on recreating the watcher.
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryPolicy controls how the watcher is recreated after failures. The
+// first retry waits RetryDelay, and every consecutive failure multiplies the
+// delay by Multiplier up to MaxDelay. A successful recreation resets it.
+type RetryPolicy struct {
+	Multiplier  float64       // growth factor per attempt (default 2, 1 keeps the delay constant)
+	MaxDelay    time.Duration // upper bound for a single delay (default 1m)
+	Jitter      float64       // randomize each delay by up to ±Jitter of its value (0 disables)
+	MaxAttempts int           // give up after this many consecutive failures (0 = never)
+	MaxElapsed  time.Duration // give up after failing for this long (0 = never)
+}
+
+// backoff tracks one streak of consecutive failures under a RetryPolicy.
+type backoff struct {
+	policy   RetryPolicy
+	initial  time.Duration
+	attempts int
+	started  time.Time
+	clock    Clock
+}
+
+func newBackoff(initial time.Duration, policy RetryPolicy, clock Clock) *backoff {
+	if policy.Multiplier == 0 {
+		policy.Multiplier = DefaultRetryMultiplier
+	}
+	if policy.MaxDelay == 0 {
+		policy.MaxDelay = DefaultMaxRetryDelay
+	}
+	return &backoff{policy: policy, initial: initial, clock: clock}
+}
+
+// next records a failure and returns how long to wait before the next
+// attempt, or an error wrapping ErrRetriesExhausted and err if the policy
+// gives up.
+func (b *backoff) next(err error) (time.Duration, error) {
+	if b.attempts == 0 {
+		b.started = b.clock.Now()
+	}
+	b.attempts++
+
+	if b.policy.MaxAttempts > 0 && b.attempts >= b.policy.MaxAttempts ||
+		b.policy.MaxElapsed > 0 && b.clock.Now().Sub(b.started) >= b.policy.MaxElapsed {
+		return 0, fmt.Errorf("%w after %d attempts: %w", ErrRetriesExhausted, b.attempts, err)
+	}
+
+	delay := float64(b.initial)
+	for i := 1; i < b.attempts && delay < float64(b.policy.MaxDelay); i++ {
+		delay *= b.policy.Multiplier
+	}
+	delay = min(delay, float64(b.policy.MaxDelay))
+	if b.policy.Jitter > 0 {
+		delay += delay * b.policy.Jitter * (2*rand.Float64() - 1) // #nosec G404 - jitter does not need crypto randomness
+	}
+	return time.Duration(delay), nil
+}
+
+// reset ends the current failure streak.
+func (b *backoff) reset() {
+	b.attempts = 0
+}
@@ -0,0 +1,76 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Delays(t *testing.T) {
+	b := newBackoff(10*time.Millisecond, RetryPolicy{MaxDelay: 40 * time.Millisecond}, RealClock{})
+	cause := errors.New("boom")
+
+	want := []time.Duration{10, 20, 40, 40}
+	for i, w := range want {
+		got, err := b.next(cause)
+		if err != nil {
+			t.Fatalf("Attempt %d: unexpected error %v", i+1, err)
+		}
+		if got != w*time.Millisecond {
+			t.Errorf("Attempt %d: expected %v, got %v", i+1, w*time.Millisecond, got)
+		}
+	}
+
+	b.reset()
+	if got, _ := b.next(cause); got != 10*time.Millisecond {
+		t.Errorf("Expected reset to start over at 10ms, got %v", got)
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, RetryPolicy{Multiplier: 1, Jitter: 0.5}, RealClock{})
+
+	for i := 0; i < 20; i++ {
+		got, _ := b.next(errors.New("boom"))
+		if got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("Delay %v outside of ±50%% jitter", got)
+		}
+	}
+}
+
+func TestWatch_RetriesExhausted(t *testing.T) {
+	// A target below a regular file can never be watched.
+	blocker := createTempFile(t)
+	target := filepath.Join(blocker, "sub", "file.txt")
+
+	var attempts int
+	config := Config{
+		TargetFile: target,
+		OnChange:   func() {},
+		RetryDelay: time.Millisecond,
+		Retry:      RetryPolicy{MaxAttempts: 3},
+		OnError: func(error) {
+			attempts++
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := Watch(ctx, config)
+	if !errors.Is(err, ErrRetriesExhausted) {
+		t.Fatalf("Expected ErrRetriesExhausted, got %v", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Watch should give up before the context deadline")
+	}
+	if !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Expected the last underlying error to be wrapped, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
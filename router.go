@@ -0,0 +1,270 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoRoute is returned by Router.HandleChange for a path no pattern
+// matches.
+var ErrNoRoute = errors.New("no route matches")
+
+// RouterConfig configures a Router.
+type RouterConfig struct {
+	OnError func(error) // errors of routes that run asynchronously
+	Clock   Clock       // time source for route debouncing (default RealClock)
+}
+
+// RouteConfig tunes a single route. With both fields zero the handler runs
+// synchronously on the watcher, which waits for it and records its error.
+// Otherwise it runs in the background, with a context that outlives the
+// watcher's call until Router.Close, and errors go to RouterConfig.OnError.
+type RouteConfig struct {
+	Debounce    time.Duration // extra wait after the watcher's debounce, restarted by every change of the same file
+	Concurrency int           // handler calls of this route that may run at once (default 1 once Debounce is set)
+}
+
+// Router dispatches changes to the handler registered for the most
+// specific pattern matching the changed path, like http.ServeMux does for
+// URLs. It is a Handler, so it can be set as MultiConfig.Handler.
+//
+// Patterns use filepath.Match syntax. An absolute pattern is matched against
+// the whole path; a relative one against as many trailing path elements as
+// it has, so "conf.d/*.yaml" matches /etc/app/conf.d/db.yaml and "*" matches
+// every file. Of several matching patterns the most specific wins:
+// absolute before relative, then more path elements, then more literal
+// (non-wildcard) characters, then the one registered first.
+type Router struct {
+	cfg        RouterConfig
+	ctx        context.Context // lifetime of asynchronous routes, ended by Close
+	cancel     context.CancelFunc
+	mu         sync.Mutex
+	routes     []*route
+	middleware []Middleware // applied to every route's handler
+}
+
+type route struct {
+	pattern  string
+	handler  Handler
+	cfg      RouteConfig
+	abs      bool
+	elems    int
+	literals int
+	sem      chan struct{}             // limits concurrent calls, nil for synchronous routes
+	pending  map[string]*pendingChange // debounced changes by path, guarded by Router.mu
+}
+
+// pendingChange is a change waiting for its route's debounce.
+type pendingChange struct {
+	ev    ChangeEvent
+	timer Timer
+}
+
+// NewRouter returns an empty Router.
+func NewRouter(cfg RouterConfig) *Router {
+	if cfg.Clock == nil {
+		cfg.Clock = RealClock{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Router{cfg: cfg, ctx: ctx, cancel: cancel}
+}
+
+// Close drops the changes waiting for a route's debounce and cancels the
+// context of the asynchronous handlers still running. Call it once the
+// watcher using the Router has returned.
+func (r *Router) Close() {
+	r.cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rt := range r.routes {
+		for path, p := range rt.pending {
+			p.timer.Stop()
+			delete(rt.pending, path)
+		}
+	}
+}
+
+// Use adds middleware around the handlers of every route, outermost first.
+// It panics if routes are already registered.
+func (r *Router) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.routes) > 0 {
+		panic("reloader: Router.Use called after routes were registered")
+	}
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Handle registers h for pattern. It panics if pattern is malformed or
+// already registered, or if h is nil.
+func (r *Router) Handle(pattern string, h Handler) {
+	r.HandleRoute(pattern, h, RouteConfig{})
+}
+
+// HandleFunc registers f for pattern, like Handle.
+func (r *Router) HandleFunc(pattern string, f func(ctx context.Context, ev ChangeEvent) error) {
+	r.HandleRoute(pattern, HandlerFunc(f), RouteConfig{})
+}
+
+// HandleRoute registers h for pattern with per-route settings, like Handle.
+func (r *Router) HandleRoute(pattern string, h Handler, cfg RouteConfig) {
+	if h == nil {
+		panic("reloader: nil handler for " + pattern)
+	}
+	pattern = filepath.Clean(pattern)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		panic(fmt.Sprintf("reloader: invalid pattern %q: %v", pattern, err))
+	}
+	if cfg.Concurrency < 0 {
+		panic(fmt.Sprintf("reloader: negative concurrency for %q", pattern))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt := &route{
+		pattern:  pattern,
+		handler:  Use(h, r.middleware...),
+		cfg:      cfg,
+		abs:      filepath.IsAbs(pattern),
+		elems:    len(strings.Split(pattern, string(filepath.Separator))),
+		literals: literals(pattern),
+	}
+	if cfg.Debounce > 0 || cfg.Concurrency > 0 {
+		rt.sem = make(chan struct{}, max(cfg.Concurrency, 1))
+		rt.pending = make(map[string]*pendingChange)
+	}
+
+	for _, existing := range r.routes {
+		if existing.pattern == pattern {
+			panic("reloader: multiple registrations for " + pattern)
+		}
+	}
+	r.routes = append(r.routes, rt)
+}
+
+// HandleChange passes ev to the route of its path. A synchronous route's
+// error is returned; a path without a route returns an error wrapping
+// ErrNoRoute. Asynchronous routes keep the values of ctx but not its
+// cancellation, since the watcher cancels it once HandleChange returns.
+func (r *Router) HandleChange(ctx context.Context, ev ChangeEvent) error {
+	r.mu.Lock()
+	rt := r.match(ev.Path)
+	switch {
+	case rt == nil:
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrNoRoute, ev.Path)
+	case rt.sem == nil:
+		r.mu.Unlock()
+		return rt.handler.HandleChange(ctx, ev)
+	case r.ctx.Err() != nil:
+		r.mu.Unlock()
+		return nil // closed
+	}
+	ctx = context.WithoutCancel(ctx)
+	switch {
+	case rt.cfg.Debounce == 0:
+		r.mu.Unlock()
+		go r.run(ctx, rt, ev)
+		return nil
+	}
+	defer r.mu.Unlock()
+
+	if p, ok := rt.pending[ev.Path]; ok {
+		p.timer.Stop()
+		ev.Op |= p.ev.Op
+	}
+	p := &pendingChange{ev: ev}
+	p.timer = r.cfg.Clock.AfterFunc(rt.cfg.Debounce, func() {
+		r.mu.Lock()
+		if rt.pending[ev.Path] != p {
+			r.mu.Unlock()
+			return // superseded by a later change
+		}
+		delete(rt.pending, ev.Path)
+		r.mu.Unlock()
+		r.run(ctx, rt, p.ev)
+	})
+	rt.pending[ev.Path] = p
+	return nil
+}
+
+// match returns the most specific route for path, or nil.
+func (r *Router) match(path string) *route {
+	var best *route
+	for _, rt := range r.routes {
+		if !rt.matches(path) {
+			continue
+		}
+		if best == nil || rt.moreSpecific(best) {
+			best = rt
+		}
+	}
+	return best
+}
+
+// run calls rt's handler once a concurrency slot is free, recovering
+// from panics since nothing else would on this goroutine. The handler's
+// context is ctx, cancelled by Close.
+func (r *Router) run(ctx context.Context, rt *route, ev ChangeEvent) {
+	select {
+	case rt.sem <- struct{}{}:
+	case <-r.ctx.Done():
+		return
+	}
+	defer func() { <-rt.sem }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(r.ctx, cancel)()
+
+	if err := protect(ctx, rt.handler, ev); err != nil && r.cfg.OnError != nil {
+		r.cfg.OnError(fmt.Errorf("route %s: %s: %w", rt.pattern, ev.Path, err))
+	}
+}
+
+func (rt *route) matches(path string) bool {
+	if !rt.abs {
+		elems := strings.Split(path, string(filepath.Separator))
+		if len(elems) < rt.elems {
+			return false
+		}
+		path = filepath.Join(elems[len(elems)-rt.elems:]...)
+	}
+	ok, _ := filepath.Match(rt.pattern, path)
+	return ok
+}
+
+func (rt *route) moreSpecific(o *route) bool {
+	switch {
+	case rt.abs != o.abs:
+		return rt.abs
+	case rt.elems != o.elems:
+		return rt.elems > o.elems
+	}
+	return rt.literals > o.literals
+}
+
+// literals counts the characters of pattern that match only themselves.
+func literals(pattern string) int {
+	n := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?':
+		case '[':
+			for i < len(pattern) && pattern[i] != ']' {
+				i++
+			}
+		case '\\':
+			i++
+			n++
+		default:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,168 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRouter_MostSpecificMatch(t *testing.T) {
+	r := NewRouter(RouterConfig{})
+	var got string
+	route := func(name string) HandlerFunc {
+		return func(context.Context, ChangeEvent) error {
+			got = name
+			return nil
+		}
+	}
+	r.Handle("*", route("any"))
+	r.Handle("*.yaml", route("yaml"))
+	r.Handle("conf.d/*.yaml", route("conf.d"))
+	r.Handle("conf.d/db.yaml", route("db"))
+	r.Handle(filepath.FromSlash("/etc/app/conf.d/*"), route("absolute"))
+	r.Handle("bin/*", route("bin"))
+
+	for path, want := range map[string]string{
+		"/srv/app.toml":            "any",
+		"/srv/app.yaml":            "yaml",
+		"/srv/conf.d/cache.yaml":   "conf.d",
+		"/srv/conf.d/db.yaml":      "db",
+		"/etc/app/conf.d/db.yaml":  "absolute",
+		"/opt/app/bin/server":      "bin",
+		"/opt/app/bin/server.yaml": "bin", // more path elements beat more literals
+	} {
+		got = ""
+		path = filepath.FromSlash(path)
+		if err := r.HandleChange(context.Background(), ChangeEvent{Path: path}); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: routed to %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRouter_NoRouteAndErrors(t *testing.T) {
+	r := NewRouter(RouterConfig{})
+	failing := errors.New("bad config")
+	r.HandleFunc("*.yaml", func(context.Context, ChangeEvent) error { return failing })
+
+	if err := r.HandleChange(context.Background(), ChangeEvent{Path: "/a.yaml"}); !errors.Is(err, failing) {
+		t.Errorf("synchronous route error not returned: %v", err)
+	}
+	if err := r.HandleChange(context.Background(), ChangeEvent{Path: "/a.json"}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate pattern did not panic")
+		}
+	}()
+	r.HandleFunc("*.yaml", func(context.Context, ChangeEvent) error { return nil })
+}
+
+func TestRouter_RouteDebounceAndConcurrency(t *testing.T) {
+	errs := make(chan error, 10)
+	r := NewRouter(RouterConfig{OnError: func(err error) { errs <- err }})
+
+	calls := make(chan ChangeEvent, 10)
+	release := make(chan struct{})
+	r.HandleRoute("*.yaml", HandlerFunc(func(_ context.Context, ev ChangeEvent) error {
+		calls <- ev
+		<-release
+		return errors.New("failed")
+	}), RouteConfig{Debounce: 50 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Changes of the same file within the route's debounce are merged.
+	start := time.Now()
+	for range 3 {
+		if err := r.HandleChange(ctx, ChangeEvent{Path: "/a.yaml"}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := r.HandleChange(ctx, ChangeEvent{Path: "/b.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-calls
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("route debounce not applied")
+	}
+	// The default concurrency of 1 holds back the second file.
+	select {
+	case ev := <-calls:
+		t.Fatalf("%s ran concurrently with %s", ev.Path, first.Path)
+	case <-time.After(100 * time.Millisecond):
+	}
+	release <- struct{}{}
+	second := <-calls
+	release <- struct{}{}
+
+	if first.Path == second.Path {
+		t.Errorf("expected one call per file, got %s twice", first.Path)
+	}
+	select {
+	case ev := <-calls:
+		t.Errorf("unexpected extra call for %s", ev.Path)
+	case <-time.After(100 * time.Millisecond):
+	}
+	for range 2 {
+		if err := <-errs; err == nil {
+			t.Error("asynchronous error not reported")
+		}
+	}
+}
+
+func TestRouter_AsyncRoutesOutliveTheCallback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("0"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRouter(RouterConfig{})
+	defer r.Close()
+	calls := make(chan error, 10)
+	r.HandleRoute("*.yaml", HandlerFunc(func(ctx context.Context, _ ChangeEvent) error {
+		time.Sleep(10 * time.Millisecond)
+		calls <- ctx.Err()
+		return nil
+	}), RouteConfig{Debounce: 20 * time.Millisecond})
+
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles:     []string{file},
+		Debounce:        10 * time.Millisecond,
+		CallbackTimeout: time.Second,
+		Handler:         r,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching != "" })
+
+	const writes = 5
+	for i := range writes {
+		if err := os.WriteFile(file, []byte(strconv.Itoa(i+1)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-calls:
+			if err != nil {
+				t.Errorf("write %d: handler context done: %v", i+1, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("write %d never reached the handler", i+1)
+		}
+	}
+}
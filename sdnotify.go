@@ -0,0 +1,121 @@
+package reloader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SystemdNotify sends state to the service manager over $NOTIFY_SOCKET, as
+// sd_notify(3) does, e.g. "READY=1" once the service has started. It does
+// nothing if NOTIFY_SOCKET is not set. Abstract socket names starting with
+// "@" are supported.
+func SystemdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	return nil
+}
+
+// systemdReloading tells systemd a reload started, as Type=notify-reload
+// units require.
+func systemdReloading(reason string) error {
+	state := "RELOADING=1\nSTATUS=Reloading: " + reason
+	if usec, ok := monotonicUsec(); ok {
+		state += "\nMONOTONIC_USEC=" + strconv.FormatInt(usec, 10)
+	}
+	return SystemdNotify(state)
+}
+
+// systemdReady tells systemd a reload finished, and in STATUS whether it
+// failed. READY=1 is sent either way: a failed reload leaves the process
+// running as before, and without it systemd would consider the reload in
+// progress until the unit's timeout.
+func systemdReady(now time.Time, err error) error {
+	if err != nil {
+		msg, _, _ := strings.Cut(err.Error(), "\n")
+		return SystemdNotify("READY=1\nSTATUS=Reload failed at " + now.Format(time.RFC3339) + ": " + msg)
+	}
+	return SystemdNotify("READY=1\nSTATUS=Reloaded at " + now.Format(time.RFC3339))
+}
+
+// reloadReason describes what triggered ev for a STATUS line.
+func reloadReason(ev ChangeEvent) string {
+	switch kind, detail, _ := strings.Cut(ev.Source, ":"); kind {
+	case "file":
+		return detail + " changed"
+	case "signal":
+		return detail + " received"
+	case "manual":
+		return "manual reload"
+	case "start":
+		return "initial load of " + ev.Path
+	case "state":
+		return ev.Path + " changed since last run"
+	case "":
+		return ev.Path + " changed"
+	}
+	return ev.Source
+}
+
+// systemdReload is a middleware that notifies systemd before and after
+// every reload. Notification errors go to onError.
+func systemdReload(clock Clock, onError func(error)) Middleware {
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, ev ChangeEvent) error {
+			report(systemdReloading(reloadReason(ev)))
+			err := next.HandleChange(ctx, ev)
+			report(systemdReady(clock.Now(), err))
+			return err
+		})
+	}
+}
+
+// systemdWatchdog returns the keepalive interval systemd asks this process
+// for through WATCHDOG_USEC and WATCHDOG_PID, or 0 if there is none.
+func systemdWatchdog() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// runWatchdog sends WATCHDOG=1 every half interval, as sd_watchdog_enabled(3)
+// recommends, until ctx is done.
+func runWatchdog(ctx context.Context, clock Clock, interval time.Duration, onError func(error)) {
+	timer := clock.NewTimer(interval / 2)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+			if err := SystemdNotify("WATCHDOG=1"); err != nil && onError != nil {
+				onError(err)
+			}
+			timer.Reset(interval / 2)
+		}
+	}
+}
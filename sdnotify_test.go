@@ -0,0 +1,118 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenNotify stands in for systemd's notification socket.
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported")
+	}
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", socket)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no notification: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestSystemdNotify_WithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := SystemdNotify("READY=1"); err != nil {
+		t.Errorf("expected no-op without NOTIFY_SOCKET, got %v", err)
+	}
+}
+
+func TestSystemdNotify_ReloadLifecycle(t *testing.T) {
+	conn := listenNotify(t)
+
+	if err := systemdReloading(reloadReason(ChangeEvent{Path: "/usr/bin/app", Source: "signal:SIGHUP"})); err != nil {
+		t.Fatal(err)
+	}
+	msg := readNotify(t, conn)
+	if !strings.HasPrefix(msg, "RELOADING=1\n") || !strings.Contains(msg, "STATUS=Reloading: SIGHUP received") {
+		t.Errorf("unexpected reloading message %q", msg)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(msg, "\nMONOTONIC_USEC=") {
+		t.Errorf("MONOTONIC_USEC missing from %q", msg)
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := systemdReady(now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readNotify(t, conn); msg != "READY=1\nSTATUS=Reloaded at 2025-01-01T00:00:00Z" {
+		t.Errorf("unexpected ready message %q", msg)
+	}
+
+	if err := systemdReady(now, errors.New("bad config\nat line 3")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readNotify(t, conn); msg != "READY=1\nSTATUS=Reload failed at 2025-01-01T00:00:00Z: bad config" {
+		t.Errorf("unexpected failure message %q", msg)
+	}
+}
+
+func TestSystemdWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+
+	t.Setenv("WATCHDOG_USEC", "40000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(1<<30))
+	if d := systemdWatchdog(); d != 0 {
+		t.Errorf("watchdog for another PID should be ignored, got %s", d)
+	}
+	t.Setenv("WATCHDOG_PID", "")
+	interval := systemdWatchdog()
+	if interval != 40*time.Millisecond {
+		t.Fatalf("interval = %s, want 40ms", interval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runWatchdog(ctx, RealClock{}, interval, nil)
+	for range 2 {
+		if msg := readNotify(t, conn); msg != "WATCHDOG=1" {
+			t.Errorf("unexpected keepalive %q", msg)
+		}
+	}
+}
+
+func TestReloadReason(t *testing.T) {
+	for _, tc := range []struct {
+		source, want string
+	}{
+		{"file:/etc/app.yaml", "/etc/app.yaml changed"},
+		{"signal:SIGHUP", "SIGHUP received"},
+		{"manual", "manual reload"},
+		{"start", "initial load of /etc/app.yaml"},
+		{"state", "/etc/app.yaml changed since last run"},
+		{"", "/etc/app.yaml changed"},
+	} {
+		if got := reloadReason(ChangeEvent{Path: "/etc/app.yaml", Source: tc.source}); got != tc.want {
+			t.Errorf("reloadReason(%q) = %q, want %q", tc.source, got, tc.want)
+		}
+	}
+}
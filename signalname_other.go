@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package reloader
+
+import "os"
+
+// signalNames is empty on this platform; signals are named by their String
+// method.
+var signalNames = map[os.Signal]string{}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package reloader
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalNames maps the signals commonly used to request a reload to their
+// names; syscall.Signal.String returns descriptions like "hangup" instead.
+var signalNames = map[os.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGUSR2: "SIGUSR2",
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package reloader
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalNames maps the signals this platform supports to their names.
+var signalNames = map[os.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGTERM: "SIGTERM",
+}
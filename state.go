@@ -0,0 +1,150 @@
+package reloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// targetRecord is what a state file remembers about a target: the content
+// the callback last saw, and the file metadata at that time.
+type targetRecord struct {
+	Digest  string    `json:"digest,omitempty"` // "" if the file did not exist
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+	Inode   uint64    `json:"inode,omitempty"`
+}
+
+// stateFile is the JSON document stored in a state file.
+type stateFile struct {
+	Targets map[string]targetRecord `json:"targets"`
+}
+
+// readState loads a state file. A missing file is an empty state.
+func readState(path string) (map[string]targetRecord, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - the state file is chosen by the caller
+	if errors.Is(err, fs.ErrNotExist) {
+		return make(map[string]targetRecord), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s stateFile
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Targets == nil {
+		s.Targets = make(map[string]targetRecord)
+	}
+	return s.Targets, nil
+}
+
+// writeState replaces the state file atomically.
+func writeState(path string, targets map[string]targetRecord) error {
+	data, err := json.MarshalIndent(stateFile{Targets: targets}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// remember returns the current record of path.
+func (e *engine) remember(path string) (targetRecord, error) {
+	digest, err := e.digest(path)
+	if err != nil {
+		return targetRecord{}, err
+	}
+	st := e.stat(path)
+	return targetRecord{Digest: digest, Size: st.size, ModTime: st.modTime, Inode: st.inode}, nil
+}
+
+// loadState compares every target against the state file and schedules a
+// change, or only reports it if stateReportOnly is set, for each one whose
+// content differs from the last run. With fireOnStart every target is
+// delivered anyway, so nothing is scheduled. Targets the state file does
+// not know yet are recorded as they are.
+func (e *engine) loadState(ctx context.Context) {
+	saved, err := readState(e.stateFile)
+	if err != nil {
+		e.reportError(fmt.Errorf("ignoring state file: %w", err))
+		saved = make(map[string]targetRecord)
+	}
+	e.saved = make(map[string]targetRecord)
+	for _, t := range e.targets {
+		current, err := e.remember(t.path)
+		if err != nil {
+			e.reportError(fmt.Errorf("failed to read %s: %w", t.path, err))
+			continue
+		}
+		before, known := saved[t.path]
+		if !known || before.Digest == current.Digest {
+			e.saved[t.path] = current
+			continue
+		}
+
+		if e.stateReportOnly {
+			e.event("changed since last run: " + t.path)
+			e.saved[t.path] = current
+			continue
+		}
+		e.event("changed since last run, reloading: " + t.path)
+		e.saved[t.path] = before // until the change is delivered
+		if e.fireOnStart {
+			continue
+		}
+		op := fsnotify.Write
+		switch {
+		case before.Digest == "":
+			op = fsnotify.Create
+		case current.Digest == "":
+			op = fsnotify.Remove
+		}
+		e.record(t, op, "state")
+		e.schedule(ctx, t.path)
+	}
+	e.saveState()
+}
+
+// stateDelivered records that the callback has seen the current content of
+// path.
+func (e *engine) stateDelivered(path string) {
+	if e.stateFile == "" {
+		return
+	}
+	current, err := e.remember(path)
+	if err != nil {
+		e.reportError(fmt.Errorf("failed to read %s: %w", path, err))
+		return
+	}
+	e.saved[path] = current
+	e.saveState()
+}
+
+func (e *engine) saveState() {
+	if err := writeState(e.stateFile, e.saved); err != nil {
+		e.reportError(fmt.Errorf("failed to write state file: %w", err))
+	}
+}
@@ -0,0 +1,132 @@
+package reloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runWithState runs a watcher of file with the given state file until
+// stop is called, sending every change to the returned channel.
+func runWithState(t *testing.T, file, state string, reportOnly bool, onEvent func(string)) (<-chan ChangeEvent, func()) {
+	t.Helper()
+	changes := make(chan ChangeEvent, 4)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles:     []string{file},
+		Debounce:        30 * time.Millisecond,
+		StateFile:       state,
+		StateReportOnly: reportOnly,
+		OnEvent:         onEvent,
+		Handler: HandlerFunc(func(_ context.Context, ev ChangeEvent) error {
+			changes <- ev
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = w.Run(ctx)
+	}()
+	waitFor(t, func() bool { return w.Status().Healthy })
+	return changes, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestState_DetectsChangesWhileDown(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	state := filepath.Join(dir, "reloader.state")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first run only records the file.
+	changes, stop := runWithState(t, file, state, false, nil)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	select {
+	case ev := <-changes:
+		t.Fatalf("unexpected change on first run: %+v", ev)
+	default:
+	}
+	if _, err := os.Stat(state); err != nil {
+		t.Fatal(err)
+	}
+
+	// Touching the file keeps its digest, so nothing fires.
+	now := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, now, now); err != nil {
+		t.Fatal(err)
+	}
+	changes, stop = runWithState(t, file, state, false, nil)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	if len(changes) != 0 {
+		t.Fatalf("touch reported as a change")
+	}
+
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changes, stop = runWithState(t, file, state, false, nil)
+	select {
+	case ev := <-changes:
+		if ev.Path != file || ev.Source != "state" {
+			t.Errorf("unexpected change: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change made while down was not delivered")
+	}
+	stop()
+
+	// Once delivered, the change is not reported again.
+	changes, stop = runWithState(t, file, state, false, nil)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	if len(changes) != 0 {
+		t.Fatalf("delivered change reported again")
+	}
+}
+
+func TestState_ReportOnly(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	state := filepath.Join(dir, "reloader.state")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, stop := runWithState(t, file, state, true, nil)
+	stop()
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var events []string
+	changes, stop := runWithState(t, file, state, true, func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, msg)
+	})
+	time.Sleep(100 * time.Millisecond)
+	stop()
+
+	if len(changes) != 0 {
+		t.Errorf("report-only change was delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(strings.Join(events, "\n"), "changed since last run: "+file) {
+		t.Errorf("change not reported: %q", events)
+	}
+}
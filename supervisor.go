@@ -0,0 +1,622 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultStopTimeout is the default time to wait for a child to exit after StopSignal.
+	DefaultStopTimeout = 10 * time.Second
+	// DefaultRestartDelay is the default time to wait before restarting a child that exited on its own.
+	DefaultRestartDelay = 1 * time.Second
+	// DefaultCrashWindow is the default period in which exits count towards MaxCrashes.
+	DefaultCrashWindow = time.Minute
+	// DefaultMaxCrashes is the default number of exits within CrashWindow after which a child is marked failed.
+	DefaultMaxCrashes = 5
+)
+
+// ErrCrashLoop is reported when a child exits MaxCrashes times within
+// CrashWindow. The supervisor stops restarting it until its binary changes.
+var ErrCrashLoop = errors.New("crash loop detected")
+
+// SupervisorConfig configures a Supervisor.
+type SupervisorConfig struct {
+	Path            string        // absolute path to the binary to run and watch (required)
+	Args            []string      // arguments passed to the binary
+	EnvFile         string        // optional dotenv file merged into the child's environment
+	Env             []string      // base environment for the child (default os.Environ())
+	Stdout          io.Writer     // child stdout (default os.Stdout)
+	Stderr          io.Writer     // child stderr (default os.Stderr)
+	StopSignal      os.Signal     // signal used to stop the child (default SIGTERM)
+	StopTimeout     time.Duration // wait for exit before killing (default 10s)
+	RestartDelay    time.Duration // wait before the first restart after an exit, doubled per crash (default 1s)
+	MaxRestartDelay time.Duration // upper bound for the restart delay (default 1m)
+	CrashWindow     time.Duration // exits within this period count as a crash loop (default 1m)
+	MaxCrashes      int           // exits within CrashWindow before giving up (default 5)
+	OnEvent         func(string)  // optional callback for logging
+	OnError         func(error)   // optional callback for logging
+	Debounce        time.Duration // wait before restarting on change (default 3s)
+	RetryDelay      time.Duration // first wait before recreating watcher, doubled per failure up to 1m unless Retry says otherwise (default 2s)
+	Retry           RetryPolicy   // backoff and give-up limits for recreating the watcher
+	Clock           Clock         // time source for all delays (default RealClock)
+	ControlSocket   string        // optional Unix socket for ServeControl / reloader ctl
+	ControlMode     fs.FileMode   // permissions of ControlSocket (default 0600)
+	HealthCheck     HealthCheck   // optional readiness probe run after the first start, every start caused by a change or reload, and a rollback; not after a restart following an exit
+	HealthTimeout   time.Duration // time to become healthy before rolling back (default 30s)
+	HealthInterval  time.Duration // wait between probes (default 1s)
+	BackupFile      string        // copy of the last healthy binary (default Path + ".prev")
+	Journal         *Journal      // optional audit log of changes, health checks and restarts
+}
+
+// Supervisor runs a child process and restarts it when its binary changes
+// or when the parsed contents of its env file change.
+type Supervisor struct {
+	cfg     SupervisorConfig
+	env     map[string]string // last parsed EnvFile contents
+	running string            // digest of the binary the current child was started from
+	crashes []time.Time       // exits within the last CrashWindow
+	failed  bool              // crash loop detected, wait for a change
+	watcher *Watcher
+	changes chan []ChangeEvent // batches of changes reported by watcher
+}
+
+// child is a single run of the supervised process.
+type child struct {
+	cmd  *exec.Cmd
+	done chan struct{} // closed once the process has exited
+	err  error         // exit error, valid after done is closed
+}
+
+// NewSupervisor validates cfg and applies defaults.
+func NewSupervisor(cfg SupervisorConfig) (*Supervisor, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("Path must be set")
+	}
+	if cfg.Env == nil {
+		cfg.Env = os.Environ()
+	}
+	if cfg.Stdout == nil {
+		cfg.Stdout = os.Stdout
+	}
+	if cfg.Stderr == nil {
+		cfg.Stderr = os.Stderr
+	}
+	if cfg.StopSignal == nil {
+		cfg.StopSignal = syscall.SIGTERM
+	}
+	if cfg.StopTimeout == 0 {
+		cfg.StopTimeout = DefaultStopTimeout
+	}
+	if cfg.RestartDelay == 0 {
+		cfg.RestartDelay = DefaultRestartDelay
+	}
+	if cfg.MaxRestartDelay == 0 {
+		cfg.MaxRestartDelay = DefaultMaxRetryDelay
+	}
+	if cfg.CrashWindow == 0 {
+		cfg.CrashWindow = DefaultCrashWindow
+	}
+	if cfg.MaxCrashes == 0 {
+		cfg.MaxCrashes = DefaultMaxCrashes
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = RealClock{}
+	}
+	if cfg.HealthTimeout == 0 {
+		cfg.HealthTimeout = DefaultHealthTimeout
+	}
+	if cfg.HealthInterval == 0 {
+		cfg.HealthInterval = DefaultHealthInterval
+	}
+	if cfg.BackupFile == "" {
+		cfg.BackupFile = cfg.Path + ".prev"
+	}
+
+	targets := []string{cfg.Path}
+	if cfg.EnvFile != "" {
+		targets = append(targets, cfg.EnvFile)
+	}
+	s := &Supervisor{cfg: cfg, changes: make(chan []ChangeEvent)}
+	w, err := NewWatcher(MultiConfig{
+		// A single action receives changes of the binary and env file
+		// made together, including a reload of every target, as one batch.
+		Actions: []Action{{
+			Name:  "restart",
+			Files: targets,
+			Run: func(ctx context.Context, changes []ChangeEvent) error {
+				select {
+				case s.changes <- changes:
+				case <-ctx.Done():
+				}
+				return nil
+			},
+		}},
+		OnEvent:    cfg.OnEvent,
+		OnError:    cfg.OnError,
+		Debounce:   cfg.Debounce,
+		RetryDelay: cfg.RetryDelay,
+		Retry:      cfg.Retry,
+		Clock:      cfg.Clock,
+		Journal:    cfg.Journal,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.watcher = w
+	return s, nil
+}
+
+// Watcher returns the watcher of the binary and env file, for use with
+// AdminHandler or ServeControl. A reload through it restarts the child
+// once, however many targets it reloads.
+func (s *Supervisor) Watcher() *Watcher {
+	return s.watcher
+}
+
+// Run starts the child and blocks until ctx is done, stopping the child
+// before returning. A Supervisor can only be run once.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if s.cfg.EnvFile != "" {
+		env, err := ReadEnvFile(s.cfg.EnvFile)
+		if err != nil {
+			return err
+		}
+		s.env = env
+	}
+
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- s.watcher.Run(ctx)
+	}()
+	if s.cfg.ControlSocket != "" {
+		go func() {
+			err := ServeControl(ctx, s.watcher, ControlConfig{
+				Socket:  s.cfg.ControlSocket,
+				Mode:    s.cfg.ControlMode,
+				OnEvent: s.cfg.OnEvent,
+				OnError: s.cfg.OnError,
+			})
+			if err != nil && ctx.Err() == nil {
+				s.reportError(fmt.Errorf("control socket: %w", err))
+			}
+		}()
+	}
+
+	exits := make(chan *child)
+	current := s.start(ctx, exits)
+	probe := s.verify(ctx, current, false)
+	defer func() { probe.stop() }()
+	restart := s.cfg.Clock.NewTimer(s.cfg.RestartDelay)
+	restart.Stop()
+	defer restart.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.stop(current)
+			return ctx.Err()
+
+		case err := <-watchErr:
+			s.stop(current)
+			return err
+
+		case err := <-probe.done():
+			if s.checked(probe, err) {
+				probe = nil
+			}
+
+		case <-probe.tick():
+			s.check(ctx, probe)
+
+		case <-probe.expired():
+			err := probe.err
+			if err == nil {
+				err = errors.New("no health check completed")
+			}
+			current, probe = s.unhealthy(ctx, probe, err, exits)
+
+		case c := <-exits:
+			if c != current {
+				continue // stopped on purpose
+			}
+			s.event(fmt.Sprintf("process exited: %v", c.err))
+			if probe != nil {
+				current, probe = s.unhealthy(ctx, probe, fmt.Errorf("process exited: %v", c.err), exits)
+				if current != c {
+					continue // rolled back
+				}
+			}
+			current = nil
+			if delay, ok := s.crashed(); ok {
+				restart.Reset(delay)
+			}
+
+		case <-restart.C():
+			current = s.start(ctx, exits)
+
+		case changes := <-s.changes:
+			if !s.restartFor(changes) {
+				continue
+			}
+			s.crashes, s.failed = nil, false
+			probe.stop()
+			s.stop(current)
+			restart.Stop()
+			current = s.start(ctx, exits)
+			probe = s.verify(ctx, current, false)
+		}
+	}
+}
+
+// restartFor reports whether changes, a batch of changes of the binary and
+// env file, call for restarting the child. A manual reload restarts it even
+// if nothing changed, but only a new binary ends a crash loop.
+func (s *Supervisor) restartFor(changes []ChangeEvent) bool {
+	var restart, newBinary bool
+	for _, ev := range changes {
+		manual := ev.Source == "manual"
+		switch ev.Path {
+		case s.cfg.EnvFile:
+			if s.envChanged(manual) {
+				restart = true
+			}
+		case s.cfg.Path:
+			if (s.failed || !manual) && s.binaryChanged() {
+				newBinary = true
+			}
+			restart = restart || manual || newBinary
+		}
+	}
+	if !restart || !s.failed {
+		return restart
+	}
+	if !newBinary {
+		s.event("crash loop: not restarting until the binary changes")
+		return false
+	}
+	s.event("binary changed, restarting after crash loop")
+	return true
+}
+
+// envChanged re-reads EnvFile and reports whether its parsed key/value set
+// differs from the one the current child was started with. A manual reload
+// restarts the child even if it does not.
+func (s *Supervisor) envChanged(manual bool) bool {
+	env, err := ReadEnvFile(s.cfg.EnvFile)
+	if err != nil {
+		s.reportError(fmt.Errorf("keeping current environment: %w", err))
+		return manual
+	}
+	if maps.Equal(env, s.env) {
+		if manual {
+			return true
+		}
+		s.event("env file changed but values are identical, not restarting")
+		s.journal(JournalEntry{Step: JournalSuppressed, Path: s.cfg.EnvFile, Detail: "values unchanged"})
+		return false
+	}
+	s.event("env changed: " + redactedKeys(DiffEnv(s.env, env)))
+	s.env = env
+	return true
+}
+
+// crashed records an exit of the current child and returns how long to wait
+// before restarting it. The delay doubles with every exit within
+// CrashWindow; once MaxCrashes is reached it returns false and the child
+// stays down until the next change.
+func (s *Supervisor) crashed() (time.Duration, bool) {
+	now := s.cfg.Clock.Now()
+	s.crashes = slices.DeleteFunc(s.crashes, func(t time.Time) bool {
+		return now.Sub(t) >= s.cfg.CrashWindow
+	})
+	s.crashes = append(s.crashes, now)
+
+	if len(s.crashes) >= s.cfg.MaxCrashes {
+		s.failed = true
+		s.reportError(fmt.Errorf("%w: %d exits within %s, not restarting %s until it changes",
+			ErrCrashLoop, len(s.crashes), s.cfg.CrashWindow, s.cfg.Path))
+		return 0, false
+	}
+
+	delay := s.cfg.RestartDelay
+	for range len(s.crashes) - 1 {
+		delay = min(2*delay, s.cfg.MaxRestartDelay)
+	}
+	s.event(fmt.Sprintf("restarting in %s (%d exits within %s)", delay, len(s.crashes), s.cfg.CrashWindow))
+	return delay, true
+}
+
+// binaryChanged reports whether Path differs from the binary the current
+// child was started from, which is not the case after a rollback or a mere
+// touch.
+func (s *Supervisor) binaryChanged() bool {
+	sum, err := digestFile(OSBackend{}, s.cfg.Path)
+	if err == nil && sum == s.running {
+		s.event("binary content unchanged, not restarting")
+		s.journal(JournalEntry{Step: JournalSuppressed, Path: s.cfg.Path, Digest: sum, Detail: "content unchanged"})
+		return false
+	}
+	return true
+}
+
+// healthProbe is the health check of a child in progress. Checks run in
+// the background so that Run keeps handling changes, exits and requests
+// while a child becomes healthy.
+type healthProbe struct {
+	c        *child
+	rollback bool               // c runs the binary restored from BackupFile
+	deadline Timer              // fires once HealthTimeout has elapsed
+	next     Timer              // fires when the next check is due, stopped while one runs
+	results  chan error         // result of the running check
+	cancel   context.CancelFunc // cancels the running check
+	err      error              // last failure
+}
+
+// done, tick and expired return the channels of p, or nil channels that
+// never fire if no probe is running.
+func (p *healthProbe) done() <-chan error {
+	if p == nil {
+		return nil
+	}
+	return p.results
+}
+
+func (p *healthProbe) tick() <-chan time.Time {
+	if p == nil {
+		return nil
+	}
+	return p.next.C()
+}
+
+func (p *healthProbe) expired() <-chan time.Time {
+	if p == nil {
+		return nil
+	}
+	return p.deadline.C()
+}
+
+// stop cancels the running check and the timers of p.
+func (p *healthProbe) stop() {
+	if p == nil {
+		return
+	}
+	p.deadline.Stop()
+	p.next.Stop()
+	p.cancel()
+}
+
+// verify starts probing c if a health check is configured and returns the
+// probe, or nil if there is nothing to probe.
+func (s *Supervisor) verify(ctx context.Context, c *child, rollback bool) *healthProbe {
+	if s.cfg.HealthCheck == nil || c == nil {
+		return nil
+	}
+	p := &healthProbe{
+		c:        c,
+		rollback: rollback,
+		deadline: s.cfg.Clock.NewTimer(s.cfg.HealthTimeout),
+		next:     s.cfg.Clock.NewTimer(s.cfg.HealthInterval),
+		results:  make(chan error, 1),
+	}
+	p.next.Stop()
+	s.check(ctx, p)
+	return p
+}
+
+// check runs one health check for p in the background, limited to
+// HealthInterval.
+func (s *Supervisor) check(ctx context.Context, p *healthProbe) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.HealthInterval)
+	p.cancel = cancel
+	results := p.results
+	go func() {
+		results <- s.cfg.HealthCheck.Check(ctx)
+	}()
+}
+
+// checked handles the result of p's running check. It returns whether the
+// probe is over because the child is healthy; after a failure the next
+// check is due in HealthInterval.
+func (s *Supervisor) checked(p *healthProbe, err error) bool {
+	p.cancel()
+	if err != nil {
+		p.err = err
+		p.next.Reset(s.cfg.HealthInterval)
+		return false
+	}
+	p.stop()
+	s.journalProbe(p.c, nil)
+	if p.rollback {
+		s.event(fmt.Sprintf("rollback succeeded: PID %d is healthy", p.c.cmd.Process.Pid))
+		return true
+	}
+	s.event(fmt.Sprintf("PID %d is healthy", p.c.cmd.Process.Pid))
+	s.backup()
+	return true
+}
+
+// unhealthy ends p, whose child did not become healthy because of err. A
+// new binary is rolled back: Path is restored from BackupFile and the
+// previous binary is started and probed instead. It returns the child
+// running afterwards and its probe, if any.
+func (s *Supervisor) unhealthy(ctx context.Context, p *healthProbe, err error, exits chan<- *child) (*child, *healthProbe) {
+	p.stop()
+	c := p.c
+	s.journalProbe(c, err)
+	if ctx.Err() != nil {
+		return c, nil
+	}
+	if p.rollback {
+		s.reportError(fmt.Errorf("previous binary is not healthy either: %w", err))
+		return c, nil
+	}
+	s.reportError(fmt.Errorf("PID %d not healthy within %s: %w", c.cmd.Process.Pid, s.cfg.HealthTimeout, err))
+
+	backup, err := digestFile(OSBackend{}, s.cfg.BackupFile)
+	if err != nil || backup == "" || backup == s.running {
+		s.event(fmt.Sprintf("no previous binary to roll back to, keeping PID %d", c.cmd.Process.Pid))
+		return c, nil
+	}
+	s.event(fmt.Sprintf("rolling back %s to %s", s.cfg.Path, s.cfg.BackupFile))
+	if err := replaceFile(s.cfg.BackupFile, s.cfg.Path); err != nil {
+		s.reportError(fmt.Errorf("rollback failed: %w", err))
+		return c, nil
+	}
+	s.stop(c)
+	c = s.start(ctx, exits)
+	return c, s.verify(ctx, c, true)
+}
+
+// backup copies Path to BackupFile unless it already holds the same binary
+// or Path was replaced again since the verified child was started.
+func (s *Supervisor) backup() {
+	if sum, err := digestFile(OSBackend{}, s.cfg.BackupFile); err == nil && sum == s.running {
+		return
+	}
+	if sum, err := digestFile(OSBackend{}, s.cfg.Path); err != nil || sum != s.running {
+		return
+	}
+	if err := replaceFile(s.cfg.Path, s.cfg.BackupFile); err != nil {
+		s.reportError(fmt.Errorf("failed to back up %s: %w", s.cfg.Path, err))
+		return
+	}
+	s.event(fmt.Sprintf("backed up healthy binary to %s", s.cfg.BackupFile))
+}
+
+// replaceFile copies src over dst atomically, keeping src's permissions.
+func replaceFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src) // #nosec G304 - src is the configured binary or its backup
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// start launches a new child. On failure it reports the error and returns
+// nil; the caller retries on the next change.
+func (s *Supervisor) start(ctx context.Context, exits chan<- *child) *child {
+	s.running, _ = digestFile(OSBackend{}, s.cfg.Path)
+
+	// #nosec G204 - running the configured binary is the point of a supervisor
+	cmd := exec.Command(s.cfg.Path, s.cfg.Args...)
+	cmd.Env = MergeEnv(s.cfg.Env, s.env)
+	cmd.Stdout = s.cfg.Stdout
+	cmd.Stderr = s.cfg.Stderr
+
+	if err := cmd.Start(); err != nil {
+		s.reportError(fmt.Errorf("failed to start %s: %w", s.cfg.Path, err))
+		return nil
+	}
+	s.event(fmt.Sprintf("started %s with PID %d", s.cfg.Path, cmd.Process.Pid))
+
+	c := &child{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		c.err = cmd.Wait()
+		close(c.done)
+		select {
+		case exits <- c:
+		case <-ctx.Done():
+		}
+	}()
+	return c
+}
+
+// stop signals the child and waits for it to exit, killing it after
+// StopTimeout.
+func (s *Supervisor) stop(c *child) {
+	if c == nil {
+		return
+	}
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	if err := c.cmd.Process.Signal(s.cfg.StopSignal); err != nil {
+		_ = c.cmd.Process.Kill()
+	}
+	timeout := s.cfg.Clock.NewTimer(s.cfg.StopTimeout)
+	defer timeout.Stop()
+	select {
+	case <-c.done:
+	case <-timeout.C():
+		s.event(fmt.Sprintf("PID %d did not stop within %s, killing", c.cmd.Process.Pid, s.cfg.StopTimeout))
+		_ = c.cmd.Process.Kill()
+		<-c.done
+	}
+	s.event(fmt.Sprintf("stopped PID %d", c.cmd.Process.Pid))
+}
+
+func (s *Supervisor) event(msg string) {
+	if s.cfg.OnEvent != nil {
+		s.cfg.OnEvent(msg)
+	}
+}
+
+// journalProbe records the result of a health check of c.
+func (s *Supervisor) journalProbe(c *child, err error) {
+	entry := JournalEntry{
+		Step:   JournalValidation,
+		Path:   s.cfg.Path,
+		Digest: s.running,
+		Detail: fmt.Sprintf("PID %d healthy", c.cmd.Process.Pid),
+	}
+	if err != nil {
+		entry.Detail = fmt.Sprintf("PID %d not healthy", c.cmd.Process.Pid)
+		entry.Error = err.Error()
+	}
+	s.journal(entry)
+}
+
+// journal appends entry to Journal, if any. Journal errors go to OnError
+// only, so they are not journaled themselves.
+func (s *Supervisor) journal(entry JournalEntry) {
+	if s.cfg.Journal == nil {
+		return
+	}
+	entry.Time = s.cfg.Clock.Now()
+	if err := s.cfg.Journal.Record(entry); err != nil && s.cfg.OnError != nil {
+		s.cfg.OnError(fmt.Errorf("journal: %w", err))
+	}
+}
+
+func (s *Supervisor) reportError(err error) {
+	s.journal(JournalEntry{Step: JournalError, Error: err.Error()})
+	if s.cfg.OnError != nil {
+		s.cfg.OnError(err)
+	}
+}
@@ -0,0 +1,264 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSupervisor_RestartsOnEnvChange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	bin := writeScript(t, dir, "echo \"$GREETING\" >> "+out+"\nexec sleep 60\n")
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("GREETING=hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	var mu sync.Mutex
+	var events []string
+
+	s, err := NewSupervisor(SupervisorConfig{
+		Path:    bin,
+		EnvFile: envFile,
+		OnEvent: func(msg string) {
+			mu.Lock()
+			events = append(events, msg)
+			mu.Unlock()
+		},
+		StopTimeout: time.Second,
+		Debounce:    50 * time.Millisecond,
+		RetryDelay:  10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewSupervisor failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+
+	// Only formatting changes: the parsed set is identical, no restart.
+	if err := os.WriteFile(envFile, []byte("# greeting\nexport GREETING='hello'\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := os.WriteFile(envFile, []byte("GREETING=bonjour\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if got := strings.Fields(string(data)); len(got) != 2 || got[0] != "hello" || got[1] != "bonjour" {
+		t.Errorf("Expected one start with each value, got %q", got)
+	}
+
+	mu.Lock()
+	gotEvents := strings.Join(events, "\n")
+	mu.Unlock()
+
+	if !strings.Contains(gotEvents, "GREETING=<redacted>") {
+		t.Errorf("Expected redacted changed key in events, got:\n%s", gotEvents)
+	}
+	if strings.Contains(gotEvents, "bonjour") {
+		t.Errorf("Env value leaked into events:\n%s", gotEvents)
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from Run: %v", err)
+	}
+}
+
+func TestSupervisor_ManualReloadRereadsEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	bin := writeScript(t, dir, "echo \"$GREETING\" >> "+out+"\nexec sleep 60\n")
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("GREETING=hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	greetings := func() []string {
+		data, _ := os.ReadFile(out)
+		return strings.Fields(string(data))
+	}
+
+	s, err := NewSupervisor(SupervisorConfig{
+		Path:        bin,
+		EnvFile:     envFile,
+		StopTimeout: time.Second,
+		Debounce:    time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewSupervisor failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	waitFor(t, func() bool { return s.Watcher().Status().Healthy && len(greetings()) == 1 })
+
+	// The reload cancels the debounced change of the env file, so it must
+	// read the new values itself.
+	if err := os.WriteFile(envFile, []byte("GREETING=bonjour\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := s.Watcher().Reload(ctx, ""); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	waitFor(t, func() bool { return len(greetings()) > 1 })
+	time.Sleep(200 * time.Millisecond)
+	// One restart for the binary and env file reloaded together.
+	if got := greetings(); len(got) != 2 || got[1] != "bonjour" {
+		t.Errorf("Expected a single restart with the new env, got %q", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from Run: %v", err)
+	}
+}
+
+func TestSupervisor_MissingPath(t *testing.T) {
+	if _, err := NewSupervisor(SupervisorConfig{}); err == nil {
+		t.Error("Expected error when Path is not set")
+	}
+}
+
+// writeScript writes an executable shell script into dir.
+func writeScript(t *testing.T, dir, body string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "app.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	return path
+}
+
+func TestSupervisor_CrashLoop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	starts := filepath.Join(dir, "starts")
+	bin := writeScript(t, dir, "echo x >> "+starts+"\nexit 1\n")
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("A=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	countStarts := func() int {
+		data, _ := os.ReadFile(starts)
+		return strings.Count(string(data), "x")
+	}
+
+	var mu sync.Mutex
+	var events []string
+	var errs []error
+	s, err := NewSupervisor(SupervisorConfig{
+		Path:         bin,
+		EnvFile:      envFile,
+		RestartDelay: 10 * time.Millisecond,
+		MaxCrashes:   3,
+		Debounce:     50 * time.Millisecond,
+		OnEvent: func(msg string) {
+			mu.Lock()
+			events = append(events, msg)
+			mu.Unlock()
+		},
+		OnError: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	// 3 starts with 10ms and 20ms between them, then nothing.
+	time.Sleep(400 * time.Millisecond)
+	if n := countStarts(); n != 3 {
+		t.Fatalf("got %d starts, want 3", n)
+	}
+	mu.Lock()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrCrashLoop) {
+		t.Errorf("expected a single ErrCrashLoop, got %v", errs)
+	}
+	if got := strings.Join(events, "\n"); !strings.Contains(got, "restarting in 20ms (2 exits") {
+		t.Errorf("restart delay did not grow, events:\n%s", got)
+	}
+	mu.Unlock()
+
+	// Neither an env change, a manual reload nor rewriting the binary with
+	// the same content restarts it.
+	if err := os.WriteFile(envFile, []byte("A=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Watcher().Reload(ctx, bin); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Count(strings.Join(events, "\n"), "crash loop: not restarting") == 2
+	})
+	same, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bin, same, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := countStarts(); n != 3 {
+		t.Fatalf("crash-looping binary restarted by a change that was not a new binary: %d starts", n)
+	}
+
+	// A new binary is started again.
+	tmp := filepath.Join(dir, "app.sh.new")
+	if err := os.WriteFile(tmp, []byte("#!/bin/sh\necho x >> "+starts+"\nexec sleep 60\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, bin); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return countStarts() == 4 })
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from Run: %v", err)
+	}
+}
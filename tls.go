@@ -0,0 +1,186 @@
+package reloader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig configures a TLSReloader.
+type TLSConfig struct {
+	CertFile   string        // PEM certificate chain (required)
+	KeyFile    string        // PEM private key (required)
+	CAFile     string        // optional PEM CA bundle used to verify peers
+	Base       *tls.Config   // optional template for GetConfigForClient
+	OnReload   func()        // optional callback after a new pair is swapped in
+	OnEvent    func(string)  // optional callback for logging
+	OnError    func(error)   // optional callback for logging
+	Debounce   time.Duration // wait before reloading (default 3s)
+	RetryDelay time.Duration // wait before recreating watcher (default 2s)
+	Retry      RetryPolicy   // backoff and give-up limits for recreating the watcher
+	Clock      Clock         // time source for debouncing, retries and expiry (default RealClock)
+}
+
+// TLSReloader keeps a certificate/key pair (and optional CA bundle) loaded
+// from disk and swaps it atomically when the files change. The cert and key
+// are treated as a unit: a new pair is only used once both files parse and
+// match, so a rotation that replaces them one at a time never serves a
+// mismatched pair.
+type TLSReloader struct {
+	cfg TLSConfig
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// NewTLSReloader loads the configured files once and returns a reloader
+// ready to be used in a tls.Config. It fails if the initial load fails.
+func NewTLSReloader(cfg TLSConfig) (*TLSReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("CertFile and KeyFile must be set")
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = RealClock{}
+	}
+	r := &TLSReloader{cfg: cfg}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch blocks until ctx is done, reloading the pair whenever any of the
+// configured files changes.
+func (r *TLSReloader) Watch(ctx context.Context) error {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.CAFile != "" {
+		files = append(files, r.cfg.CAFile)
+	}
+
+	return WatchMultiple(ctx, MultiConfig{
+		TargetFiles: files,
+		OnChange: func(string) {
+			if err := r.load(); err != nil {
+				// Expected mid-rotation; the next write triggers another attempt.
+				r.event("keeping current certificate: " + err.Error())
+				return
+			}
+			if r.cfg.OnReload != nil {
+				r.cfg.OnReload()
+			}
+		},
+		OnEvent:    r.cfg.OnEvent,
+		OnError:    r.cfg.OnError,
+		Debounce:   r.cfg.Debounce,
+		RetryDelay: r.cfg.RetryDelay,
+		Retry:      r.cfg.Retry,
+		Clock:      r.cfg.Clock,
+	})
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *TLSReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *TLSReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// GetConfigForClient implements tls.Config.GetConfigForClient. It returns a
+// clone of cfg.Base carrying the current certificate and, if CAFile is set,
+// the current CA bundle as ClientCAs.
+func (r *TLSReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	var c *tls.Config
+	if r.cfg.Base != nil {
+		c = r.cfg.Base.Clone()
+	} else {
+		c = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c.Certificates = []tls.Certificate{*r.cert}
+	c.GetCertificate = nil
+	c.GetConfigForClient = nil
+	if r.pool != nil {
+		c.ClientCAs = r.pool
+	}
+	return c, nil
+}
+
+// RootCAs returns the current CA bundle, or nil if CAFile is not set.
+func (r *TLSReloader) RootCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// Expiry returns the NotAfter time of the current leaf certificate.
+func (r *TLSReloader) Expiry() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert.Leaf.NotAfter
+}
+
+// load reads and validates all files and swaps them in only if every one of
+// them is usable.
+func (r *TLSReloader) load() error {
+	certPEM, err := os.ReadFile(r.cfg.CertFile)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(r.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid key pair: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.mu.Unlock()
+
+	leaf := cert.Leaf
+	r.event(fmt.Sprintf("certificate loaded: subject=%q expires=%s (in %s)",
+		leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339),
+		leaf.NotAfter.Sub(r.cfg.Clock.Now()).Round(time.Hour)))
+	return nil
+}
+
+func (r *TLSReloader) event(msg string) {
+	if r.cfg.OnEvent != nil {
+		r.cfg.OnEvent(msg)
+	}
+}
@@ -0,0 +1,182 @@
+package reloader
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTLSReloader_InitialLoad(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "v1", 24*time.Hour)
+
+	r, err := NewTLSReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewTLSReloader failed: %v", err)
+	}
+
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cert == nil {
+		t.Fatalf("GetCertificate returned %v, %v", cert, err)
+	}
+	if cert.Leaf.Subject.CommonName != "v1" {
+		t.Errorf("Expected CN v1, got %q", cert.Leaf.Subject.CommonName)
+	}
+	if until := time.Until(r.Expiry()); until <= 0 || until > 25*time.Hour {
+		t.Errorf("Unexpected expiry %v", r.Expiry())
+	}
+
+	if _, err := NewTLSReloader(TLSConfig{CertFile: certFile}); err == nil {
+		t.Error("Expected error when KeyFile is missing")
+	}
+}
+
+func TestTLSReloader_SwapsOnlyMatchingPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "v1", 24*time.Hour)
+
+	var mu sync.Mutex
+	var reloads int
+	var events []string
+
+	r, err := NewTLSReloader(TLSConfig{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		OnReload: func() {
+			mu.Lock()
+			reloads++
+			mu.Unlock()
+		},
+		OnEvent: func(msg string) {
+			mu.Lock()
+			events = append(events, msg)
+			mu.Unlock()
+		},
+		Debounce:   50 * time.Millisecond,
+		RetryDelay: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewTLSReloader failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Watch(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Rotate the key first: the old cert no longer matches, so v1 must stay.
+	newDir := t.TempDir()
+	newCert, newKey := writeKeyPair(t, newDir, "v2", 48*time.Hour)
+	copyFile(t, newKey, keyFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if cn := currentCN(t, r); cn != "v1" {
+		t.Fatalf("Expected v1 to be kept after key-only rotation, got %q", cn)
+	}
+
+	// Now the cert catches up and the pair matches again.
+	copyFile(t, newCert, certFile)
+	time.Sleep(200 * time.Millisecond)
+
+	if cn := currentCN(t, r); cn != "v2" {
+		t.Errorf("Expected v2 after cert rotation, got %q", cn)
+	}
+
+	mu.Lock()
+	gotReloads := reloads
+	gotEvents := strings.Join(events, "\n")
+	mu.Unlock()
+
+	if gotReloads != 1 {
+		t.Errorf("Expected exactly 1 reload, got %d", gotReloads)
+	}
+	if !strings.Contains(gotEvents, "keeping current certificate") {
+		t.Errorf("Expected mismatch to be reported, got events:\n%s", gotEvents)
+	}
+	if !strings.Contains(gotEvents, "expires=") {
+		t.Errorf("Expected expiry to be reported, got events:\n%s", gotEvents)
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error from Watch: %v", err)
+	}
+}
+
+func currentCN(t *testing.T, r *TLSReloader) string {
+	t.Helper()
+
+	cfg, err := r.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetConfigForClient failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+// writeKeyPair writes a self-signed certificate and its key into dir.
+func writeKeyPair(t *testing.T, dir, cn string, validFor time.Duration) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", src, err)
+	}
+	if err := os.WriteFile(dst, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", dst, err)
+	}
+}
@@ -0,0 +1,151 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNotRunning is returned by Watcher methods when Run is not active.
+	ErrNotRunning = errors.New("watcher is not running")
+	// ErrUnknownTarget is returned by Watcher.Reload and Watcher.Remove for
+	// a path that is not one of the watched files.
+	ErrUnknownTarget = errors.New("not a watched file")
+)
+
+// Status is a point-in-time view of a Watcher.
+type Status struct {
+	Healthy bool           `json:"healthy"`         // event source open and no target given up
+	Paused  bool           `json:"paused"`          // changes are held until Resume
+	Error   string         `json:"error,omitempty"` // last error reported to OnError
+	Targets []TargetStatus `json:"targets"`
+}
+
+// TargetStatus describes one watched file.
+type TargetStatus struct {
+	Path        string    `json:"path"`
+	Watching    string    `json:"watching,omitempty"`     // directory currently watched for it
+	LastChange  time.Time `json:"last_change,omitzero"`   // when a change was last detected
+	LastReload  time.Time `json:"last_reload,omitzero"`   // when the callback last ran
+	ReloadError string    `json:"reload_error,omitempty"` // error of the last reload, "" if it succeeded
+	Reloads     int       `json:"reloads"`                // number of callback invocations
+	Pending     time.Time `json:"pending,omitzero"`       // when the pending debounce timer fires
+	Held        bool      `json:"held,omitempty"`         // a change is held until Resume
+	WatchError  string    `json:"watch_error,omitempty"`  // set once retries to watch it are exhausted
+}
+
+// Watcher is a handle on a WatchMultiple-style watcher that can be
+// inspected and driven from other goroutines while Run is active.
+type Watcher struct {
+	e       *engine
+	running atomic.Bool
+}
+
+// NewWatcher validates cfg and returns a Watcher for it. At most one of
+// cfg.OnChange, cfg.Handler and cfg.Actions can be set, and one of them or a
+// per-operation callback such as cfg.OnRemove must be. A dependency cycle
+// among cfg.Actions is reported as an error wrapping ErrDependencyCycle.
+func NewWatcher(cfg MultiConfig) (*Watcher, error) {
+	e, err := newMultiEngine(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.OnChange == nil && cfg.Handler == nil && e.actions == nil && !e.opCallbacks.set():
+		return nil, errors.New("OnChange callback must be set")
+	case cfg.OnChange != nil && cfg.Handler != nil:
+		return nil, errors.New("only one of OnChange and Handler can be set")
+	case e.actions != nil && (cfg.OnChange != nil || cfg.Handler != nil):
+		return nil, errors.New("OnChange and Handler cannot be used with Actions")
+	case e.actions != nil && len(cfg.Middleware) > 0:
+		return nil, errors.New("Middleware cannot be used with Actions")
+	}
+
+	if cfg.Handler != nil {
+		e.onChange = cfg.Handler.HandleChange
+	} else if cfg.OnChange != nil {
+		e.onChange = func(_ context.Context, ev ChangeEvent) error {
+			cfg.OnChange(ev.Path)
+			return nil
+		}
+	}
+	return &Watcher{e: e}, nil
+}
+
+// Run blocks until ctx is done, or until cfg.Retry gives up, like
+// WatchMultiple. A Watcher can only be run once.
+func (w *Watcher) Run(ctx context.Context) error {
+	if !w.running.CompareAndSwap(false, true) {
+		return errors.New("watcher already started")
+	}
+	return w.e.run(ctx)
+}
+
+// Status returns the current state of every target.
+func (w *Watcher) Status() Status {
+	return w.e.status()
+}
+
+// Reload invokes the callback for path right away, as if a change had just
+// been debounced, and returns its error. An empty path reloads every target.
+// A pending debounce for the target is cancelled and its operations are
+// included in the event.
+func (w *Watcher) Reload(ctx context.Context, path string) error {
+	return w.do(ctx, func(ctx context.Context, _ EventSource) error {
+		return w.e.reload(ctx, path)
+	})
+}
+
+// Pause holds debounced changes instead of delivering them until Resume.
+// Changes are still detected and debounced while paused, and the content
+// of every target is recorded.
+func (w *Watcher) Pause(ctx context.Context) error {
+	return w.do(ctx, func(context.Context, EventSource) error {
+		w.e.pause()
+		return nil
+	})
+}
+
+// Resume delivers a single change for each target that changed since
+// Pause, however often it changed, and returns their errors. Targets whose
+// content is back to what it was when paused are not reloaded.
+func (w *Watcher) Resume(ctx context.Context) error {
+	return w.do(ctx, func(ctx context.Context, _ EventSource) error {
+		return w.e.resume(ctx)
+	})
+}
+
+// Add starts watching another file. It is watched like the configured
+// targets, including when its directory does not exist yet.
+func (w *Watcher) Add(ctx context.Context, path string) error {
+	return w.do(ctx, func(ctx context.Context, src EventSource) error {
+		return w.e.add(ctx, src, path)
+	})
+}
+
+// Remove stops watching path, dropping its pending change if any.
+func (w *Watcher) Remove(ctx context.Context, path string) error {
+	return w.do(ctx, func(_ context.Context, src EventSource) error {
+		return w.e.remove(src, path)
+	})
+}
+
+// do runs fn on the watcher's event loop and returns its error. It waits
+// for the loop to pick fn up, which does not happen while the event source
+// is being recreated.
+func (w *Watcher) do(ctx context.Context, fn func(context.Context, EventSource) error) error {
+	if !w.running.Load() {
+		return ErrNotRunning
+	}
+	req := request{fn: fn, done: make(chan error, 1)}
+	select {
+	case w.e.requests <- req:
+	case <-w.e.done:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.done
+}
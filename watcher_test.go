@@ -0,0 +1,375 @@
+package reloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcher_StatusRecordsReloadResults(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := errors.New("bad config")
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{file},
+		Debounce:    30 * time.Millisecond,
+		Handler: HandlerFunc(func(context.Context, ChangeEvent) error {
+			return failing
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching == dir })
+	if err := os.WriteFile(file, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return !w.Status().Targets[0].Pending.IsZero() })
+	waitFor(t, func() bool { return w.Status().Targets[0].Reloads == 1 })
+
+	st := w.Status().Targets[0]
+	if st.LastChange.IsZero() || st.LastReload.IsZero() {
+		t.Errorf("times not recorded: %+v", st)
+	}
+	if st.ReloadError == "" || !st.Pending.IsZero() {
+		t.Errorf("expected a failed reload and nothing pending: %+v", st)
+	}
+}
+
+func TestWatcher_ManualReload(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+
+	reloaded := make(chan string, 2)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{a, b},
+		OnChange:    func(path string) { reloaded <- path },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Reload(context.Background(), a); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Reload before Run = %v, want ErrNotRunning", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy })
+
+	if err := w.Reload(ctx, b); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := <-reloaded; got != b {
+		t.Errorf("reloaded %q, want %q", got, b)
+	}
+	if err := w.Reload(ctx, ""); err != nil {
+		t.Fatalf("Reload of all targets failed: %v", err)
+	}
+	if len(reloaded) != 2 {
+		t.Errorf("got %d reloads, want 2", len(reloaded))
+	}
+	if err := w.Reload(ctx, filepath.Join(dir, "c")); !errors.Is(err, ErrUnknownTarget) {
+		t.Errorf("Reload of unknown path = %v, want ErrUnknownTarget", err)
+	}
+}
+
+func TestNewWatcher_RequiresExactlyOneCallback(t *testing.T) {
+	if _, err := NewWatcher(MultiConfig{TargetFiles: []string{"/tmp/x"}}); err == nil {
+		t.Error("expected an error without a callback")
+	}
+	_, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{"/tmp/x"},
+		OnChange:    func(string) {},
+		Handler:     HandlerFunc(func(context.Context, ChangeEvent) error { return nil }),
+	})
+	if err == nil {
+		t.Error("expected an error with both callbacks")
+	}
+}
+
+func TestWatcher_PauseCoalescesChanges(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, f := range []string{a, b} {
+		if err := os.WriteFile(f, []byte("original"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded := make(chan ChangeEvent, 10)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{a, b},
+		Debounce:    20 * time.Millisecond,
+		Handler: HandlerFunc(func(_ context.Context, ev ChangeEvent) error {
+			reloaded <- ev
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy })
+
+	if err := w.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a changes twice, several debounce windows apart; b changes and is
+	// restored.
+	for _, step := range []struct{ file, content string }{
+		{a, "first"}, {b, "temporary"}, {a, "second"}, {b, "original"},
+	} {
+		if err := os.WriteFile(step.file, []byte(step.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+	waitFor(t, func() bool {
+		st := w.Status()
+		return st.Targets[0].Held && st.Targets[1].Held
+	})
+	if len(reloaded) != 0 {
+		t.Fatal("change delivered while paused")
+	}
+
+	if err := w.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded) != 1 {
+		t.Fatalf("got %d reloads on resume, want 1", len(reloaded))
+	}
+	if ev := <-reloaded; ev.Path != a || !ev.Op.Has(fsnotify.Write) {
+		t.Errorf("reloaded %+v, want a write to %s", ev, a)
+	}
+
+	// The restored file is still reloaded on its next change.
+	if err := os.WriteFile(b, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-reloaded:
+		if ev.Path != b {
+			t.Errorf("reloaded %q, want %q", ev.Path, b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no reload after resume")
+	}
+}
+
+func TestWatcher_SignalTriggersReload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cannot send SIGHUP")
+	}
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	reloaded := make(chan ChangeEvent, 10)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{a, b},
+		Debounce:    100 * time.Millisecond,
+		Signals:     []os.Signal{syscall.SIGHUP},
+		Handler: HandlerFunc(func(_ context.Context, ev ChangeEvent) error {
+			reloaded <- ev
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy })
+
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return !w.Status().Targets[0].Pending.IsZero() })
+	// A write during the same debounce window is merged into the change.
+	if err := os.WriteFile(a, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]ChangeEvent)
+	for range 2 {
+		select {
+		case ev := <-reloaded:
+			got[ev.Path] = ev
+		case <-time.After(time.Second):
+			t.Fatalf("expected a reload of both targets, got %v", got)
+		}
+	}
+	if ev := got[b]; ev.Source != "signal:SIGHUP" || ev.Op != 0 {
+		t.Errorf("b: got %+v, want a signal-triggered change", ev)
+	}
+	if ev := got[a]; ev.Source != "file:"+a || !ev.Op.Has(fsnotify.Create) {
+		t.Errorf("a: got %+v, want the file change to be the last trigger", ev)
+	}
+
+	if err := w.Reload(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-reloaded; ev.Source != "manual" {
+		t.Errorf("manual reload has source %q", ev.Source)
+	}
+}
+
+func TestWatcher_FireOnStart(t *testing.T) {
+	dir := t.TempDir()
+	present, missing := filepath.Join(dir, "present"), filepath.Join(dir, "missing")
+	if err := os.WriteFile(present, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan ChangeEvent, 4)
+	missed := make(chan string, 2)
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles: []string{present, missing},
+		Debounce:    30 * time.Millisecond,
+		FireOnStart: true,
+		OnMissing:   func(path string) { missed <- path },
+		Handler: HandlerFunc(func(_ context.Context, ev ChangeEvent) error {
+			changes <- ev
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case ev := <-changes:
+		if ev.Path != present || ev.Source != "start" || !ev.Op.Has(fsnotify.Create) {
+			t.Errorf("unexpected initial event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("existing target not delivered on start")
+	}
+	if got := <-missed; got != missing {
+		t.Errorf("OnMissing(%q), want %q", got, missing)
+	}
+
+	if err := os.WriteFile(missing, []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-changes:
+		if ev.Path != missing || ev.Source != "file:"+missing {
+			t.Errorf("unexpected event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing target not delivered once created")
+	}
+}
+
+func TestWatcher_RecoversPanicsAndTimesOut(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 4)
+	calls := 0
+	cancelled := make(chan struct{})
+	w, err := NewWatcher(MultiConfig{
+		TargetFiles:     []string{file},
+		Debounce:        30 * time.Millisecond,
+		CallbackTimeout: 50 * time.Millisecond,
+		OnError:         func(err error) { errs <- err },
+		Handler: HandlerFunc(func(ctx context.Context, _ ChangeEvent) error {
+			calls++
+			switch calls {
+			case 1:
+				panic("bad config")
+			case 2:
+				<-ctx.Done()
+				close(cancelled)
+				select {} // ignore the cancellation and hang
+			}
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	waitFor(t, func() bool { return w.Status().Healthy && w.Status().Targets[0].Watching == dir })
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("b")
+	var perr *PanicError
+	if err := <-errs; !errors.As(err, &perr) || perr.Value != "bad config" || len(perr.Stack) == 0 {
+		t.Fatalf("expected a PanicError with a stack, got %v", err)
+	}
+	waitFor(t, func() bool { return w.Status().Targets[0].ReloadError != "" })
+	if st := w.Status().Targets[0]; strings.Contains(st.ReloadError, "\n") {
+		t.Errorf("multi-line reload error in status: %q", st.ReloadError)
+	}
+
+	write("c")
+	if err := <-errs; !errors.Is(err, ErrHandlerTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	<-cancelled
+
+	// The watcher keeps running despite the callback left behind.
+	write("d")
+	waitFor(t, func() bool { return w.Status().Targets[0].Reloads == 3 })
+	if st := w.Status().Targets[0]; st.ReloadError != "" {
+		t.Errorf("third reload failed: %s", st.ReloadError)
+	}
+}